@@ -0,0 +1,16 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/country"
+	"net/http"
+)
+
+// countriesMaxAge is how long clients may cache the list of countries, it changes only with new releases
+const countriesMaxAge = "public, max-age=86400"
+
+// listCountries defines endpoint listing ISO 3166-1 countries which can be set as country of the user
+func (s *Server) listCountries(ctx *gin.Context) {
+	ctx.Header("Cache-Control", countriesMaxAge)
+	ctx.JSON(http.StatusOK, country.All())
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/rafdekar/user-api/country"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListCountriesApi(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := newTestServer(t, mockdb.NewMockStore(ctrl))
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/countries", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, countriesMaxAge, recorder.Header().Get("Cache-Control"))
+
+	var response []country.Country
+	err = json.Unmarshal(recorder.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, country.All(), response)
+	require.Contains(t, response, country.Country{Alpha2: "PL", Alpha3: "POL", Numeric: "616", Name: "Poland"})
+}
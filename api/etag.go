@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// errPreconditionRequired is returned when a request changing the user does not have If-Match header
+	errPreconditionRequired = apperror.New(apperror.KindPreconditionRequired, "precondition_required",
+		"If-Match header with the entity tag of the user is required")
+	// errPreconditionFailed is returned when the user was changed since the caller read it
+	errPreconditionFailed = apperror.New(apperror.KindPreconditionFailed, "precondition_failed",
+		"user was modified, fetch it again and retry the request")
+)
+
+// userETag derives a strong entity tag of the user from its version, which is incremented on every change
+func userETag(user db.User) string {
+	return fmt.Sprintf(`"%d"`, user.Version)
+}
+
+// setUserCacheHeaders sets validators which clients can use in conditional requests
+func setUserCacheHeaders(ctx *gin.Context, user db.User) {
+	ctx.Header("ETag", userETag(user))
+	ctx.Header("Last-Modified", user.ModifiedAt.UTC().Format(http.TimeFormat))
+}
+
+// isNotModified evaluates If-None-Match and If-Modified-Since headers as described in RFC 7232,
+// If-Modified-Since is ignored when If-None-Match is present
+func isNotModified(ctx *gin.Context, user db.User) bool {
+	if ifNoneMatch := ctx.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, userETag(user))
+	}
+
+	if ifModifiedSince := ctx.GetHeader("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		// HTTP dates have one second precision
+		return !user.ModifiedAt.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// checkIfMatch evaluates If-Match header against the current user as described in RFC 7232,
+// it responds with 412 and returns false when none of the entity tags matches
+func checkIfMatch(ctx *gin.Context, ifMatch string, user db.User) bool {
+	if !etagMatchesStrong(ifMatch, userETag(user)) {
+		setUserCacheHeaders(ctx, user)
+		respondWithError(ctx, errPreconditionFailed)
+		return false
+	}
+
+	return true
+}
+
+// etagMatches checks if any of the comma separated entity tags from the header matches etag,
+// weak comparison is used so "W/" prefixes are ignored
+func etagMatches(header string, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagMatchesStrong checks if any of the comma separated entity tags from the header matches etag,
+// strong comparison is used so weak entity tags never match
+func etagMatchesStrong(header string, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"github.com/rafdekar/user-api/apperror"
+	"github.com/rafdekar/user-api/country"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"strings"
+	"time"
+)
+
+// codeInvalidSort is returned when sort parameter refers to a field users can not be sorted by
+const codeInvalidSort = "invalid_sort"
+
+// errSortedCursor is returned when cursor pagination is combined with sort, cursors only follow
+// the (created_at, id) order
+var errSortedCursor = &apperror.Error{
+	Kind:    apperror.KindInvalid,
+	Code:    codeInvalidSort,
+	Message: "sort can not be used with cursor pagination",
+	Fields:  []apperror.FieldError{{Field: "sort", Code: codeInvalidSort, Message: "must not be combined with limit or after"}},
+}
+
+// userFilterRequest holds filters shared by both pagination modes of listUsers, time ranges are RFC 3339
+// timestamps and include their from and exclude their to bound
+type userFilterRequest struct {
+	Country        string    `form:"country" json:"-" binding:"omitempty,iso3166_alpha2"`
+	EmailDomain    string    `form:"email_domain" json:"-" binding:"omitempty,fqdn"`
+	NicknamePrefix string    `form:"nickname_prefix" json:"-" binding:"omitempty,max=255"`
+	CreatedFrom    time.Time `form:"created_from" json:"-"`
+	CreatedTo      time.Time `form:"created_to" json:"-" binding:"omitempty,gtfield=CreatedFrom"`
+	ModifiedFrom   time.Time `form:"modified_from" json:"-"`
+	ModifiedTo     time.Time `form:"modified_to" json:"-" binding:"omitempty,gtfield=ModifiedFrom"`
+}
+
+// params converts the filters into parameters of ListUsersFiltered
+func (r userFilterRequest) params() db.ListUsersFilteredParams {
+	return db.ListUsersFilteredParams{
+		Country:        country.Normalize(r.Country),
+		EmailDomain:    r.EmailDomain,
+		NicknamePrefix: r.NicknamePrefix,
+		CreatedFrom:    r.CreatedFrom,
+		CreatedTo:      r.CreatedTo,
+		ModifiedFrom:   r.ModifiedFrom,
+		ModifiedTo:     r.ModifiedTo,
+	}
+}
+
+// parseUserSort parses comma separated list of fields, e.g. -created_at,last_name, fields prefixed
+// with - are sorted in descending order
+func parseUserSort(sort string) ([]db.UserSort, error) {
+	if sort == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(sort, ",")
+	result := make([]db.UserSort, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		userSort := db.UserSort{Field: strings.TrimSpace(field)}
+		if strings.HasPrefix(userSort.Field, "-") {
+			userSort.Field = userSort.Field[1:]
+			userSort.Descending = true
+		}
+
+		if !db.IsUserSortField(userSort.Field) || seen[userSort.Field] {
+			return nil, &apperror.Error{
+				Kind:    apperror.KindInvalid,
+				Code:    codeInvalidSort,
+				Message: "sort is invalid",
+				Fields: []apperror.FieldError{{
+					Field:   "sort",
+					Code:    codeInvalidSort,
+					Message: "users can not be sorted by " + field,
+				}},
+			}
+		}
+
+		seen[userSort.Field] = true
+		result = append(result, userSort)
+	}
+
+	return result, nil
+}
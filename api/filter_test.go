@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/rafdekar/user-api/apperror"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseUserSort(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sort    string
+		want    []db.UserSort
+		wantErr bool
+	}{
+		{name: "Empty", sort: "", want: nil},
+		{name: "Single", sort: "nickname", want: []db.UserSort{{Field: "nickname"}}},
+		{
+			name: "Multiple",
+			sort: "-created_at, last_name",
+			want: []db.UserSort{{Field: "created_at", Descending: true}, {Field: "last_name"}},
+		},
+		{name: "Unknown Field", sort: "password", wantErr: true},
+		{name: "Duplicate Field", sort: "last_name,-last_name", wantErr: true},
+		{name: "Empty Field", sort: "last_name,", wantErr: true},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			sort, err := parseUserSort(v.sort)
+			if v.wantErr {
+				require.Equal(t, codeInvalidSort, apperror.Classify(err).Code)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, v.want, sort)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/apperror"
+)
+
+// Routes which take the user ID or list parameters in the JSON body are kept only for backward compatibility,
+// they respond with Deprecation header and point to their successors with Link header. Their clients predate
+// conditional requests, so If-Match is checked when they send it but not required.
+
+// setDeprecationHeaders marks response of a deprecated route and links the route which replaces it
+func setDeprecationHeaders(ctx *gin.Context, successor string) {
+	ctx.Header("Deprecation", "true")
+	ctx.Header("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+}
+
+type legacyUpdateUserRequest struct {
+	ID uuid.UUID `json:"id" binding:"required"`
+	updateUserRequest
+}
+
+// legacyUpdateUser defines deprecated endpoint for updating user with ID passed in the body, use PUT /users/:id instead
+func (s *Server) legacyUpdateUser(ctx *gin.Context) {
+	request := &legacyUpdateUserRequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	setDeprecationHeaders(ctx, "/users/"+request.ID.String())
+	s.updateUserByID(ctx, request.ID, &request.updateUserRequest, false)
+}
+
+type legacyDeleteUserRequest struct {
+	ID uuid.UUID `json:"ID" binding:"required"`
+}
+
+// legacyDeleteUser defines deprecated endpoint for deleting user with ID passed in the body, use DELETE /users/:id instead
+func (s *Server) legacyDeleteUser(ctx *gin.Context) {
+	request := &legacyDeleteUserRequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	setDeprecationHeaders(ctx, "/users/"+request.ID.String())
+	s.deleteUserByID(ctx, request.ID, false)
+}
+
+// bindListUsersRequest binds list parameters from the query string, or from the JSON body of deprecated
+// GET /users requests which do not have any query string, it reports whether the request is deprecated
+func bindListUsersRequest(ctx *gin.Context, request *listUsersRequest) (bool, error) {
+	if ctx.Request.URL.RawQuery == "" && ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(request); err != nil {
+			return true, err
+		}
+
+		successor := fmt.Sprintf("/users?page_size=%d&page_number=%d", request.PageSize, request.PageNumber)
+		setDeprecationHeaders(ctx, successor)
+		return true, nil
+	}
+
+	return false, ctx.ShouldBindQuery(request)
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func requireDeprecated(t *testing.T, recorder *httptest.ResponseRecorder, successor string) {
+	require.Equal(t, "true", recorder.Header().Get("Deprecation"))
+	require.Equal(t, `<`+successor+`>; rel="successor-version"`, recorder.Header().Get("Link"))
+}
+
+func TestLegacyUpdateUserApi(t *testing.T) {
+	user := randomUser()
+	dbParams := db.UpdateUserParams{
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Password:  user.Password,
+		Nickname:  user.Nickname,
+		Country:   user.Country,
+		Version:   user.Version,
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(user, nil)
+	store.EXPECT().UpdateUser(gomock.Any(), eqUpdateUserParams(dbParams, user.Password)).
+		Times(1).
+		Return(user, nil)
+
+	server := newTestServer(t, store)
+
+	body, err := json.Marshal(legacyUpdateUserRequest{
+		ID: user.ID,
+		updateUserRequest: updateUserRequest{
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Email:     user.Email,
+			Password:  user.Password,
+			Nickname:  user.Nickname,
+			Country:   user.Country,
+		},
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("PUT", "/users", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	req.Header.Set("If-Match", userETag(user))
+
+	addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+	server.router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireDeprecated(t, recorder, "/users/"+user.ID.String())
+	requireBodyMatchUser(t, recorder.Body, &user)
+}
+
+func TestLegacyUpdateUserApiWithoutIfMatch(t *testing.T) {
+	user := randomUser()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(user, nil)
+	store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.UpdateUserParams) (db.User, error) {
+			// the version read just before keeps concurrent writes from being lost in between
+			require.Equal(t, user.Version, arg.Version)
+			return user, nil
+		})
+
+	server := newTestServer(t, store)
+
+	body, err := json.Marshal(legacyUpdateUserRequest{
+		ID: user.ID,
+		updateUserRequest: updateUserRequest{
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Email:     user.Email,
+			Password:  user.Password,
+			Nickname:  user.Nickname,
+			Country:   user.Country,
+		},
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("PUT", "/users", bytes.NewBuffer(body))
+	require.NoError(t, err)
+
+	addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+	server.router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireDeprecated(t, recorder, "/users/"+user.ID.String())
+}
+
+func TestLegacyUpdateUserApiValidation(t *testing.T) {
+	user := randomUser()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newTestServer(t, store)
+
+	// fields of the embedded updateUserRequest are validated as well
+	body, err := json.Marshal(legacyUpdateUserRequest{
+		ID: user.ID,
+		updateUserRequest: updateUserRequest{
+			FirstName: "123",
+			LastName:  user.LastName,
+			Email:     user.Email,
+			Password:  user.Password,
+			Nickname:  user.Nickname,
+			Country:   user.Country,
+		},
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("PUT", "/users", bytes.NewBuffer(body))
+	require.NoError(t, err)
+
+	addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+	server.router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestLegacyDeleteUserApi(t *testing.T) {
+	user := randomUser()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(user, nil)
+	store.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(db.DeleteUserParams{ID: user.ID, Version: user.Version})).
+		Times(1).
+		Return(int64(1), nil)
+	store.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(nil)
+
+	server := newTestServer(t, store)
+
+	body, err := json.Marshal(legacyDeleteUserRequest{ID: user.ID})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("DELETE", "/users", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	req.Header.Set("If-Match", userETag(user))
+
+	addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+	server.router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireDeprecated(t, recorder, "/users/"+user.ID.String())
+}
+
+func TestLegacyListUsersApi(t *testing.T) {
+	users := []db.User{randomUser(), randomUser()}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(db.ListUsersFilteredParams{Limit: 2, Offset: 2})).
+		Times(1).
+		Return(users, nil)
+
+	server := newTestServer(t, store)
+
+	body, err := json.Marshal(listUsersRequest{
+		PageSize:   2,
+		PageNumber: 2,
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/users", bytes.NewBuffer(body))
+	require.NoError(t, err)
+
+	addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, users[0].ID, []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+	server.router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireDeprecated(t, recorder, "/users?page_size=2&page_number=2")
+	requireBodyMatchUsers(t, recorder.Body, users)
+}
+
+func TestLegacyDeleteUserApiWithoutIfMatch(t *testing.T) {
+	user := randomUser()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(user, nil)
+	store.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(db.DeleteUserParams{ID: user.ID, Version: user.Version})).
+		Times(1).
+		Return(int64(1), nil)
+	store.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(nil)
+
+	server := newTestServer(t, store)
+
+	body, err := json.Marshal(legacyDeleteUserRequest{ID: user.ID})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("DELETE", "/users", bytes.NewBuffer(body))
+	require.NoError(t, err)
+
+	addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+	server.router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireDeprecated(t, recorder, "/users/"+user.ID.String())
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/apperror"
+	"github.com/rafdekar/user-api/lockout"
+	"github.com/rafdekar/user-api/security"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errLoginLocked does not tell whether the account or the IP is locked, so that it does not reveal which accounts exist
+var errLoginLocked = apperror.New(apperror.KindTooManyRequests, "login_locked", "too many failed logins, try again later")
+
+// Keys of the lockout store are prefixed, so that accounts, unknown logins and IPs can share it
+func accountLockoutKey(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+// loginLockoutKey counts failures of logins which do not match any account, so that they get locked
+// just like existing accounts
+func loginLockoutKey(login string) string {
+	return "login:" + strings.ToLower(login)
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+// emitEvent reports a security event of the request
+func (s *Server) emitEvent(ctx *gin.Context, event security.Event) {
+	event.Time = s.now().UTC()
+	if event.IP == "" {
+		event.IP = ctx.ClientIP()
+	}
+
+	s.events.Emit(ctx, event)
+}
+
+// checkLockout responds with 429 and Retry-After header and returns false when the key is locked,
+// userID is the account the key belongs to if there is one
+func (s *Server) checkLockout(ctx *gin.Context, l *lockout.Lockout, key string, userID *uuid.UUID) bool {
+	retryAfter, err := l.Check(ctx, key)
+	if err != nil {
+		respondWithError(ctx, err)
+		return false
+	}
+
+	if retryAfter > 0 {
+		lockedUntil := s.now().Add(retryAfter).UTC()
+		s.emitEvent(ctx, security.Event{Type: security.LoginLocked, UserID: userID, LockedUntil: &lockedUntil})
+
+		setRetryAfter(ctx, retryAfter)
+		respondWithError(ctx, errLoginLocked)
+		return false
+	}
+
+	return true
+}
+
+// failLogin counts the failure against the account key and the IP of the client and responds with invalid
+// credentials, even when the failure locks them the next login finds out
+func (s *Server) failLogin(ctx *gin.Context, accountKey string, userID *uuid.UUID) {
+	account, err := s.accountLockout.Fail(ctx, accountKey)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ip, err := s.ipLockout.Fail(ctx, ipLockoutKey(ctx.ClientIP()))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	s.emitEvent(ctx, security.Event{Type: security.LoginFailed, UserID: userID, Failures: account.Failures})
+	if !account.LockedUntil.IsZero() {
+		lockedUntil := account.LockedUntil.UTC()
+		s.emitEvent(ctx, security.Event{
+			Type:        security.AccountLocked,
+			UserID:      userID,
+			Failures:    account.Failures,
+			LockedUntil: &lockedUntil,
+		})
+	}
+	if !ip.LockedUntil.IsZero() {
+		lockedUntil := ip.LockedUntil.UTC()
+		s.emitEvent(ctx, security.Event{Type: security.IPLocked, Failures: ip.Failures, LockedUntil: &lockedUntil})
+	}
+
+	respondWithError(ctx, errInvalidCredentials)
+}
+
+type lockoutResponse struct {
+	Locked        bool       `json:"locked"`
+	Failures      int        `json:"failures"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// getLockout defines endpoint for checking failed logins of the user and whether their account is locked
+func (s *Server) getLockout(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !lockoutPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	attempts, err := s.accountLockout.Status(ctx, accountLockoutKey(id))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	response := lockoutResponse{Failures: attempts.Failures}
+	if !attempts.LastFailureAt.IsZero() {
+		lastFailureAt := attempts.LastFailureAt.UTC()
+		response.LastFailureAt = &lastFailureAt
+	}
+	if attempts.LockedUntil.After(s.now()) {
+		lockedUntil := attempts.LockedUntil.UTC()
+		response.Locked = true
+		response.LockedUntil = &lockedUntil
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// unlockUser defines endpoint for unlocking account of the user and forgetting its failed logins,
+// locks of IPs the failures came from are kept
+func (s *Server) unlockUser(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	payload := authorizationPayload(ctx)
+	if !lockoutPolicy.allows(payload, id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	_, err := s.store.GetUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errUserNotFound)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	err = s.accountLockout.Reset(ctx, accountLockoutKey(id))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	s.emitEvent(ctx, security.Event{Type: security.AccountUnlocked, UserID: &id, ActorID: &payload.UserID})
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/password"
+	"github.com/rafdekar/user-api/security"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// postLogin sends login request from the IP to the server
+func postLogin(t *testing.T, server *Server, login string, plainPassword string, ip string) *httptest.ResponseRecorder {
+	body, err := json.Marshal(loginUserRequest{Login: login, Password: plainPassword})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("POST", "/users/login", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	req.RemoteAddr = ip + ":41000"
+
+	server.router.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+// newTestLockoutServer returns test server which keeps security events in memory
+func newTestLockoutServer(t *testing.T, store db.Store) (*Server, *security.MemoryEmitter) {
+	server := newTestServer(t, store)
+	events := security.NewMemoryEmitter()
+	server.events = events
+
+	return server, events
+}
+
+// eventTypes returns types of the events in the order they were emitted
+func eventTypes(events []security.Event) []string {
+	types := make([]string, len(events))
+	for i, v := range events {
+		types[i] = v.Type
+	}
+
+	return types
+}
+
+func TestAccountLockoutApi(t *testing.T) {
+	plainPassword := util.RandomWord(10)
+
+	hasher, err := password.NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	hashedPassword, err := hasher.Hash(plainPassword)
+	require.NoError(t, err)
+
+	user := randomUser()
+	user.Password = hashedPassword
+	admin := randomUser()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server, events := newTestLockoutServer(t, store)
+	attempts := server.config.LockoutAccountAttempts
+
+	store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(user, nil)
+
+	// every failure over the free attempts locks the account, yet the request which locked it still gets 401
+	for i := 0; i <= attempts; i++ {
+		recorder := postLogin(t, server, user.Nickname, util.RandomWord(10), fmt.Sprintf("192.0.2.%d", i))
+		requireProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+	}
+
+	// the right password does not help from any IP while the account is locked
+	recorder := postLogin(t, server, user.Nickname, plainPassword, "198.51.100.1")
+	requireProblem(t, recorder, http.StatusTooManyRequests, "login_locked")
+	require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+
+	emitted := events.Events()
+	require.Len(t, emitted, attempts+3)
+	require.Equal(t, security.AccountLocked, emitted[attempts+1].Type)
+	require.Equal(t, user.ID, *emitted[attempts+1].UserID)
+	require.Equal(t, attempts+1, emitted[attempts+1].Failures)
+	require.Equal(t, security.LoginLocked, emitted[attempts+2].Type)
+	require.Equal(t, "198.51.100.1", emitted[attempts+2].IP)
+
+	// administrators can check the lock and lift it
+	recorder = sendAuthorizedRequest(t, server, "GET", fmt.Sprintf("/users/%s/lockout", user.ID), nil, admin.ID, []string{util.RoleUser, util.RoleAdmin})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	response := &lockoutResponse{}
+	err = json.Unmarshal(recorder.Body.Bytes(), response)
+	require.NoError(t, err)
+	require.True(t, response.Locked)
+	require.Equal(t, attempts+1, response.Failures)
+	require.NotNil(t, response.LockedUntil)
+
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(user, nil)
+
+	recorder = sendAuthorizedRequest(t, server, "DELETE", fmt.Sprintf("/users/%s/lockout", user.ID), nil, admin.ID, []string{util.RoleUser, util.RoleAdmin})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	unlocked := events.Events()[len(events.Events())-1]
+	require.Equal(t, security.AccountUnlocked, unlocked.Type)
+	require.Equal(t, user.ID, *unlocked.UserID)
+	require.Equal(t, admin.ID, *unlocked.ActorID)
+
+	store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(db.UserMfa{}, sql.ErrNoRows)
+	store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return([]string{}, nil)
+	store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.Session{}, nil)
+
+	recorder = postLogin(t, server, user.Nickname, plainPassword, "198.51.100.1")
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestLoginSuccessResetsFailuresApi(t *testing.T) {
+	plainPassword := util.RandomWord(10)
+
+	hasher, err := password.NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	hashedPassword, err := hasher.Hash(plainPassword)
+	require.NoError(t, err)
+
+	user := randomUser()
+	user.Password = hashedPassword
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server, _ := newTestLockoutServer(t, store)
+	attempts := server.config.LockoutAccountAttempts
+
+	store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(user, nil)
+	store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(db.UserMfa{}, sql.ErrNoRows)
+	store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return([]string{}, nil)
+	store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.Session{}, nil)
+
+	for i := 0; i < attempts; i++ {
+		recorder := postLogin(t, server, user.Nickname, util.RandomWord(10), "192.0.2.1")
+		requireProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+	}
+
+	recorder := postLogin(t, server, user.Nickname, plainPassword, "192.0.2.1")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// failures are counted from zero again, so the next failure does not lock the account
+	recorder = postLogin(t, server, user.Nickname, util.RandomWord(10), "192.0.2.1")
+	requireProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+
+	recorder = sendAuthorizedRequest(t, server, "GET", fmt.Sprintf("/users/%s/lockout", user.ID), nil, uuid.New(), []string{util.RoleAdmin})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"locked":false,"failures":1`)
+}
+
+func TestUnknownLoginLockoutApi(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server, events := newTestLockoutServer(t, store)
+	attempts := server.config.LockoutAccountAttempts
+
+	store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+		Times(attempts+2).
+		Return(db.User{}, sql.ErrNoRows)
+
+	for i := 0; i <= attempts; i++ {
+		recorder := postLogin(t, server, "Nobody", util.RandomWord(10), fmt.Sprintf("192.0.2.%d", i))
+		requireProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+	}
+
+	// logins which do not match any account are locked just like accounts, so locks do not reveal which exist
+	recorder := postLogin(t, server, "nobody", util.RandomWord(10), "198.51.100.1")
+	requireProblem(t, recorder, http.StatusTooManyRequests, "login_locked")
+
+	for _, v := range events.Events() {
+		require.Nil(t, v.UserID)
+	}
+}
+
+// recordingHasher records hashes passwords are verified against
+type recordingHasher struct {
+	password.Hasher
+	verified []string
+}
+
+func (h *recordingHasher) Verify(hash string, plainPassword string) error {
+	h.verified = append(h.verified, hash)
+	return h.Hasher.Verify(hash, plainPassword)
+}
+
+func TestUnknownLoginVerifiesPasswordApi(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server, _ := newTestLockoutServer(t, store)
+	hasher := &recordingHasher{Hasher: server.hasher}
+	server.hasher = hasher
+
+	store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.User{}, sql.ErrNoRows)
+
+	// unknown logins cost the same password check as wrong passwords, so response times do not reveal which exist
+	recorder := postLogin(t, server, util.RandomWord(10), util.RandomWord(10), "192.0.2.1")
+	requireProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+	require.Equal(t, []string{server.dummyPasswordHash}, hasher.verified)
+	require.False(t, server.hasher.NeedsRehash(server.dummyPasswordHash))
+}
+
+func TestIPLockoutApi(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server, events := newTestLockoutServer(t, store)
+	attempts := server.config.LockoutIPAttempts
+
+	// once the IP is locked its requests do not reach the database
+	store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+		Times(attempts+2).
+		Return(db.User{}, sql.ErrNoRows)
+
+	for i := 0; i <= attempts; i++ {
+		recorder := postLogin(t, server, util.RandomWord(10), util.RandomWord(10), "192.0.2.1")
+		requireProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+	}
+	require.Contains(t, eventTypes(events.Events()), security.IPLocked)
+
+	recorder := postLogin(t, server, util.RandomWord(10), util.RandomWord(10), "192.0.2.1")
+	requireProblem(t, recorder, http.StatusTooManyRequests, "login_locked")
+	require.NotEmpty(t, recorder.Header().Get("Retry-After"))
+
+	// other IPs can still log in
+	recorder = postLogin(t, server, util.RandomWord(10), util.RandomWord(10), "192.0.2.2")
+	requireProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+}
+
+func TestLockoutPolicyApi(t *testing.T) {
+	user := randomUser()
+
+	testCases := []struct {
+		name          string
+		method        string
+		roles         []string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Get Forbidden",
+			method: "GET",
+			roles:  []string{util.RoleUser, util.RoleSupport},
+			buildStubs: func(store *mockdb.MockStore) {
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "Unlock Forbidden",
+			method: "DELETE",
+			roles:  []string{util.RoleUser},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "Unlock User Not Found",
+			method: "DELETE",
+			roles:  []string{util.RoleUser, util.RoleAdmin},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server, _ := newTestLockoutServer(t, store)
+
+			v.buildStubs(store)
+
+			// users can not unlock themselves either
+			recorder := sendAuthorizedRequest(t, server, v.method, fmt.Sprintf("/users/%s/lockout", user.ID), nil, user.ID, v.roles)
+			v.checkResponse(t, recorder)
+		})
+	}
+}
@@ -2,10 +2,55 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/lockout"
+	"github.com/rafdekar/user-api/mail"
+	"github.com/rafdekar/user-api/password"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 	"os"
 	"testing"
+	"time"
 )
 
+func newTestServer(t *testing.T, store db.Store) *Server {
+	config := util.Config{
+		PasswordHashAlgorithm:          password.Bcrypt,
+		BcryptCost:                     bcrypt.MinCost,
+		TokenAlgorithm:                 token.AlgorithmHS256,
+		TokenSecretKey:                 util.RandomWord(32),
+		AccessTokenDuration:            time.Minute,
+		RefreshTokenDuration:           time.Hour,
+		NameMinLength:                  1,
+		NameMaxLength:                  50,
+		Mailer:                         mail.Memory,
+		EmailVerificationURL:           "https://example.com/verify-email",
+		EmailVerificationTokenDuration: time.Hour,
+		PasswordResetURL:               "https://example.com/reset-password",
+		PasswordResetTokenDuration:     time.Hour,
+		PasswordResetEmailLimit:        3,
+		PasswordResetIPLimit:           20,
+		PasswordResetLimitWindow:       time.Hour,
+		MFAIssuer:                      "User API",
+		MFATokenDuration:               time.Minute,
+		MFAAttemptLimit:                5,
+		MFAAttemptWindow:               time.Minute,
+		LockoutStore:                   lockout.Memory,
+		LockoutAccountAttempts:         3,
+		LockoutIPAttempts:              10,
+		LockoutBaseDelay:               time.Minute,
+		LockoutMaxDelay:                time.Hour,
+		LockoutFailureRetention:        24 * time.Hour,
+	}
+
+	server, err := NewServer(config, store)
+	require.NoError(t, err)
+
+	return server
+}
+
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 	os.Exit(m.Run())
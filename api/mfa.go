@@ -0,0 +1,490 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/apperror"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/totp"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes users get at once
+	recoveryCodeCount = 10
+	// recoveryCodeSize is the number of random bytes of recovery code, they are encoded into 16 base32 characters
+	recoveryCodeSize = 10
+)
+
+var (
+	errMFAAlreadyEnabled = apperror.New(apperror.KindConflict, "mfa_already_enabled", "MFA is already enabled")
+	errMFANotEnabled     = apperror.New(apperror.KindConflict, "mfa_not_enabled", "MFA is not enabled")
+	errMFANotEnrolled    = apperror.New(apperror.KindConflict, "mfa_not_enrolled", "MFA enrollment has not been started")
+	errInvalidMFACode    = apperror.New(apperror.KindInvalid, "invalid_mfa_code", "MFA code is invalid")
+	// errMFALoginFailed does not tell wrong, reused and recovery codes apart
+	errMFALoginFailed = apperror.New(apperror.KindUnauthorized, "invalid_mfa_code", "MFA code or recovery code is invalid")
+)
+
+// recoveryCodeEncoding encodes recovery codes, base32 has no characters which are easy to confuse when typed
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns recovery codes formatted for users, e.g. ABCD-EFGH-IJKL-MNOP, and their hashes
+// which are stored instead of them
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buffer := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(buffer); err != nil {
+			return nil, nil, err
+		}
+
+		encoded := recoveryCodeEncoding.EncodeToString(buffer)
+		groups := make([]string, 0, len(encoded)/4)
+		for j := 0; j < len(encoded); j += 4 {
+			groups = append(groups, encoded[j:j+4])
+		}
+
+		codes[i] = strings.Join(groups, "-")
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes the code regardless of case, dashes and spaces users type it with, recovery codes
+// are random enough to be hashed like tokens rather than passwords
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code)))
+}
+
+// replaceRecoveryCodes generates new recovery codes of the user, codes generated before stop working
+func (s *Server) replaceRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.ReplaceMFARecoveryCodesTx(ctx, db.CreateMFARecoveryCodesParams{
+		UserID:     userID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// mfaEnabled reports whether the user confirmed MFA enrollment
+func (s *Server) mfaEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	mfa, err := s.store.GetUserMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return mfa.ConfirmedAt.Valid, nil
+}
+
+// secondFactorRequest holds one of the second factors, either code from authenticator app or recovery code
+type secondFactorRequest struct {
+	Code         string `json:"code" binding:"required_without=RecoveryCode,omitempty,numeric"`
+	RecoveryCode string `json:"recovery_code" binding:"omitempty,max=64"`
+}
+
+// checkSecondFactor checks the code or the recovery code against enabled MFA of the user and uses it up, so that
+// it can not be entered again. It responds with the error invalid or 429 and returns false when the factor is wrong.
+func (s *Server) checkSecondFactor(ctx *gin.Context, mfa db.UserMfa, request secondFactorRequest, invalid error) bool {
+	if !allowRequest(ctx, s.mfaLimiter, mfa.UserID.String()) {
+		return false
+	}
+
+	var used int64
+	var err error
+	if request.Code != "" {
+		counter, ok := totp.Validate(mfa.Secret, request.Code, s.now())
+		if !ok {
+			respondWithError(ctx, invalid)
+			return false
+		}
+
+		used, err = s.store.UseMFACode(ctx, db.UseMFACodeParams{
+			UserID:          mfa.UserID,
+			LastUsedCounter: counter,
+		})
+	} else {
+		used, err = s.store.UseMFARecoveryCode(ctx, db.UseMFARecoveryCodeParams{
+			UserID:   mfa.UserID,
+			CodeHash: hashRecoveryCode(request.RecoveryCode),
+		})
+	}
+	if err != nil {
+		respondWithError(ctx, err)
+		return false
+	}
+
+	if used == 0 {
+		respondWithError(ctx, invalid)
+		return false
+	}
+
+	return true
+}
+
+type loginMFAResponse struct {
+	MFARequired       bool      `json:"mfa_required"`
+	MFAToken          string    `json:"mfa_token"`
+	MFATokenExpiresAt time.Time `json:"mfa_token_expires_at"`
+}
+
+// requireMFA responds to login of user with enabled MFA, instead of a session they get MFA token which lets
+// them finish logging in with the second factor
+func (s *Server) requireMFA(ctx *gin.Context, user db.User) {
+	mfaToken, mfaPayload, err := s.tokenMaker.CreateToken(user.ID, nil, token.TypeMFA, s.config.MFATokenDuration)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loginMFAResponse{
+		MFARequired:       true,
+		MFAToken:          mfaToken,
+		MFATokenExpiresAt: mfaPayload.ExpiredAt,
+	})
+}
+
+type loginUserMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	secondFactorRequest
+}
+
+// loginUserMFA defines endpoint for exchanging MFA token and the second factor for access and refresh tokens
+func (s *Server) loginUserMFA(ctx *gin.Context) {
+	request := &loginUserMFARequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	mfaPayload, err := s.tokenMaker.VerifyToken(request.MFAToken, token.TypeMFA)
+	if err != nil {
+		respondWithError(ctx, tokenError(err, apperror.KindUnauthorized))
+		return
+	}
+
+	mfa, err := s.store.GetUserMFA(ctx, mfaPayload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errMFALoginFailed)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	if !mfa.ConfirmedAt.Valid {
+		respondWithError(ctx, errMFALoginFailed)
+		return
+	}
+
+	if !s.checkSecondFactor(ctx, mfa, request.secondFactorRequest, errMFALoginFailed) {
+		return
+	}
+
+	user, err := s.store.GetUser(ctx, mfaPayload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errInvalidCredentials)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	s.startSession(ctx, user, true)
+}
+
+type mfaResponse struct {
+	Enabled           bool       `json:"enabled"`
+	ConfirmedAt       *time.Time `json:"confirmed_at,omitempty"`
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+// getMFA defines endpoint for checking whether the user enabled MFA and how many recovery codes they have left
+func (s *Server) getMFA(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !getMFAPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	mfa, err := s.store.GetUserMFA(ctx, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(ctx, err)
+		return
+	}
+
+	response := mfaResponse{}
+	if err == nil && mfa.ConfirmedAt.Valid {
+		response.Enabled = true
+		response.ConfirmedAt = &mfa.ConfirmedAt.Time
+
+		response.RecoveryCodesLeft, err = s.store.CountMFARecoveryCodes(ctx, id)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+type enrollMFAResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+// enrollMFA defines endpoint for starting MFA enrollment, it returns a new secret which has to be confirmed
+// with the first code, enrolling again before that replaces the secret
+func (s *Server) enrollMFA(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !enrollMFAPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	user, err := s.store.GetUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errUserNotFound)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	_, err = s.store.CreateUserMFA(ctx, db.CreateUserMFAParams{
+		UserID: id,
+		Secret: secret,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errMFAAlreadyEnabled)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollMFAResponse{
+		Secret:     secret,
+		OtpauthURI: totp.URI(s.config.MFAIssuer, user.Email, secret),
+	})
+}
+
+type confirmMFARequest struct {
+	Code string `json:"code" binding:"required,numeric"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// confirmMFA defines endpoint for finishing MFA enrollment with the first code from authenticator app,
+// it returns recovery codes which are never shown again
+func (s *Server) confirmMFA(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !enrollMFAPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	request := &confirmMFARequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	if !allowRequest(ctx, s.mfaLimiter, id.String()) {
+		return
+	}
+
+	mfa, err := s.store.GetUserMFA(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errMFANotEnrolled)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	if mfa.ConfirmedAt.Valid {
+		respondWithError(ctx, errMFAAlreadyEnabled)
+		return
+	}
+
+	counter, ok := totp.Validate(mfa.Secret, request.Code, s.now())
+	if !ok {
+		respondWithError(ctx, errInvalidMFACode)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	_, err = s.store.ConfirmMFATx(ctx, db.ConfirmMFATxParams{
+		UserID:          id,
+		LastUsedCounter: counter,
+		CodeHashes:      hashes,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errMFAAlreadyEnabled)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// enabledMFA reads MFA of the user, it responds with an error and returns false when it is not enabled
+func (s *Server) enabledMFA(ctx *gin.Context, userID uuid.UUID) (db.UserMfa, bool) {
+	mfa, err := s.store.GetUserMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errMFANotEnabled)
+			return db.UserMfa{}, false
+		}
+		respondWithError(ctx, err)
+		return db.UserMfa{}, false
+	}
+
+	if !mfa.ConfirmedAt.Valid {
+		respondWithError(ctx, errMFANotEnabled)
+		return db.UserMfa{}, false
+	}
+
+	return mfa, true
+}
+
+// regenerateRecoveryCodes defines endpoint for replacing recovery codes, e.g. when most of them were used,
+// it requires the second factor
+func (s *Server) regenerateRecoveryCodes(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !enrollMFAPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	request := &secondFactorRequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	mfa, ok := s.enabledMFA(ctx, id)
+	if !ok {
+		return
+	}
+
+	if !s.checkSecondFactor(ctx, mfa, *request, errInvalidMFACode) {
+		return
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, id)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// disableMFA defines endpoint for disabling MFA or cancelling pending enrollment. Users disabling their enabled MFA
+// have to enter the second factor, administrators reset it without one for users who lost their authenticator.
+// All sessions of the user are revoked, since some of them were authenticated with the factor.
+func (s *Server) disableMFA(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	payload := authorizationPayload(ctx)
+	if !disableMFAPolicy.allows(payload, id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	mfa, err := s.store.GetUserMFA(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errMFANotEnabled)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	if mfa.ConfirmedAt.Valid && payload.UserID == id {
+		request := &secondFactorRequest{}
+		if err := ctx.ShouldBindJSON(request); err != nil {
+			respondWithError(ctx, apperror.Invalid(err))
+			return
+		}
+
+		if !s.checkSecondFactor(ctx, mfa, *request, errInvalidMFACode) {
+			return
+		}
+	}
+
+	// sessions authenticated with the factor exist only when MFA was enabled, not during pending enrollment
+	err = s.store.DisableMFATx(ctx, db.DisableMFATxParams{
+		UserID:         id,
+		RevokeSessions: mfa.ConfirmedAt.Valid,
+	})
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
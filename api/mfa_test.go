@@ -0,0 +1,760 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/totp"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mfaTestTime is the time the server sees while checking codes in tests
+var mfaTestTime = time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestMFAServer returns test server with stopped clock
+func newTestMFAServer(t *testing.T, store db.Store) *Server {
+	server := newTestServer(t, store)
+	server.now = func() time.Time {
+		return mfaTestTime
+	}
+
+	return server
+}
+
+// randomMFA returns confirmed MFA of the user with a new secret
+func randomMFA(t *testing.T, userID uuid.UUID) db.UserMfa {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	return db.UserMfa{
+		UserID:      userID,
+		Secret:      secret,
+		ConfirmedAt: sql.NullTime{Time: mfaTestTime.Add(-time.Hour), Valid: true},
+	}
+}
+
+// mfaCode returns the code authenticator app shows at mfaTestTime
+func mfaCode(t *testing.T, mfa db.UserMfa) string {
+	code, err := totp.Code(mfa.Secret, mfaTestTime)
+	require.NoError(t, err)
+
+	return code
+}
+
+// sendAuthorizedRequest sends request with JSON body authorized as the user with given roles
+func sendAuthorizedRequest(
+	t *testing.T,
+	server *Server,
+	method string,
+	path string,
+	body interface{},
+	userID uuid.UUID,
+	roles []string,
+) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest(method, path, bytes.NewBuffer(data))
+	require.NoError(t, err)
+
+	addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, userID, roles, time.Minute)
+	server.router.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestGetMFAApi(t *testing.T) {
+	user := randomUser()
+	mfa := randomMFA(t, user.ID)
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Enabled",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().CountMFARecoveryCodes(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(int64(7), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &mfaResponse{}
+				err := json.Unmarshal(recorder.Body.Bytes(), response)
+				require.NoError(t, err)
+				require.True(t, response.Enabled)
+				require.NotNil(t, response.ConfirmedAt)
+				require.Equal(t, int64(7), response.RecoveryCodesLeft)
+			},
+		},
+		{
+			name: "Pending Enrollment",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{UserID: user.ID, Secret: mfa.Secret}, nil)
+				store.EXPECT().CountMFARecoveryCodes(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"enabled":false,"recovery_codes_left":0}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "Not Enrolled",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"enabled":false,"recovery_codes_left":0}`, recorder.Body.String())
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestMFAServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := sendAuthorizedRequest(t, server, "GET", fmt.Sprintf("/users/%s/mfa", user.ID), nil, user.ID, []string{util.RoleUser})
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestEnrollMFAApi(t *testing.T) {
+	user := randomUser()
+
+	testCases := []struct {
+		name          string
+		userID        uuid.UUID
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			userID: user.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().CreateUserMFA(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.CreateUserMFAParams) (db.UserMfa, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.NotEmpty(t, arg.Secret)
+						return db.UserMfa{UserID: arg.UserID, Secret: arg.Secret}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &enrollMFAResponse{}
+				err := json.Unmarshal(recorder.Body.Bytes(), response)
+				require.NoError(t, err)
+				require.NotEmpty(t, response.Secret)
+				require.Equal(t, totp.URI("User API", user.Email, response.Secret), response.OtpauthURI)
+			},
+		},
+		{
+			name:   "Already Enabled",
+			userID: user.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().CreateUserMFA(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusConflict, "mfa_already_enabled")
+			},
+		},
+		{
+			name:   "Other User",
+			userID: uuid.New(),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUserMFA(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestMFAServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := sendAuthorizedRequest(t, server, "POST", fmt.Sprintf("/users/%s/mfa", v.userID), nil, user.ID, []string{util.RoleUser})
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestConfirmMFAApi(t *testing.T) {
+	user := randomUser()
+	mfa := randomMFA(t, user.ID)
+	pending := mfa
+	pending.ConfirmedAt = sql.NullTime{}
+
+	testCases := []struct {
+		name          string
+		body          confirmMFARequest
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: confirmMFARequest{Code: mfaCode(t, mfa)},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(pending, nil)
+				store.EXPECT().ConfirmMFATx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ConfirmMFATxParams) (db.UserMfa, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.Equal(t, totp.Counter(mfaTestTime), arg.LastUsedCounter)
+						require.Len(t, arg.CodeHashes, recoveryCodeCount)
+						return mfa, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &recoveryCodesResponse{}
+				err := json.Unmarshal(recorder.Body.Bytes(), response)
+				require.NoError(t, err)
+				require.Len(t, response.RecoveryCodes, recoveryCodeCount)
+				for _, code := range response.RecoveryCodes {
+					require.Regexp(t, `^[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}$`, code)
+				}
+			},
+		},
+		{
+			name: "Invalid Code",
+			body: confirmMFARequest{Code: "000000"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(pending, nil)
+				store.EXPECT().ConfirmMFATx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, "invalid_mfa_code")
+			},
+		},
+		{
+			name: "Not Enrolled",
+			body: confirmMFARequest{Code: mfaCode(t, mfa)},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusConflict, "mfa_not_enrolled")
+			},
+		},
+		{
+			name: "Already Enabled",
+			body: confirmMFARequest{Code: mfaCode(t, mfa)},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().ConfirmMFATx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusConflict, "mfa_already_enabled")
+			},
+		},
+		{
+			name: "Bad Request",
+			body: confirmMFARequest{Code: "abcdef"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestMFAServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := sendAuthorizedRequest(t, server, "POST", fmt.Sprintf("/users/%s/mfa/confirm", user.ID), v.body, user.ID, []string{util.RoleUser})
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLoginUserMFAApi(t *testing.T) {
+	user := randomUser()
+	mfa := randomMFA(t, user.ID)
+	recoveryCode := "abcd-efgh-ijkl-mnop"
+
+	testCases := []struct {
+		name          string
+		body          func(t *testing.T, tokenMaker token.Maker) loginUserMFARequest
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: func(t *testing.T, tokenMaker token.Maker) loginUserMFARequest {
+				return loginUserMFARequest{
+					MFAToken:            createTestMFAToken(t, tokenMaker, user.ID),
+					secondFactorRequest: secondFactorRequest{Code: mfaCode(t, mfa)},
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().UseMFACode(gomock.Any(), gomock.Eq(db.UseMFACodeParams{UserID: user.ID, LastUsedCounter: totp.Counter(mfaTestTime)})).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]string{util.RoleAdmin}, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.CreateSessionParams) (db.Session, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.True(t, arg.MfaAuthenticated)
+						return db.Session{ID: arg.ID, UserID: arg.UserID, MfaAuthenticated: true}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &loginUserResponse{}
+				err := json.Unmarshal(recorder.Body.Bytes(), response)
+				require.NoError(t, err)
+
+				accessPayload, err := server.tokenMaker.VerifyToken(response.AccessToken, token.TypeAccess)
+				require.NoError(t, err)
+				require.Equal(t, []string{util.RoleUser, util.RoleAdmin}, accessPayload.Roles)
+			},
+		},
+		{
+			name: "Recovery Code",
+			body: func(t *testing.T, tokenMaker token.Maker) loginUserMFARequest {
+				return loginUserMFARequest{
+					MFAToken:            createTestMFAToken(t, tokenMaker, user.ID),
+					secondFactorRequest: secondFactorRequest{RecoveryCode: recoveryCode},
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				params := db.UseMFARecoveryCodeParams{UserID: user.ID, CodeHash: hashRecoveryCode(strings.ToUpper(recoveryCode))}
+				store.EXPECT().UseMFARecoveryCode(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]string{}, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{}, nil)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Replayed Code",
+			body: func(t *testing.T, tokenMaker token.Maker) loginUserMFARequest {
+				return loginUserMFARequest{
+					MFAToken:            createTestMFAToken(t, tokenMaker, user.ID),
+					secondFactorRequest: secondFactorRequest{Code: mfaCode(t, mfa)},
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().UseMFACode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusUnauthorized, "invalid_mfa_code")
+			},
+		},
+		{
+			name: "Wrong Code",
+			body: func(t *testing.T, tokenMaker token.Maker) loginUserMFARequest {
+				return loginUserMFARequest{
+					MFAToken:            createTestMFAToken(t, tokenMaker, user.ID),
+					secondFactorRequest: secondFactorRequest{Code: "000000"},
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().UseMFACode(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusUnauthorized, "invalid_mfa_code")
+			},
+		},
+		{
+			name: "Access Token",
+			body: func(t *testing.T, tokenMaker token.Maker) loginUserMFARequest {
+				accessToken, _, err := tokenMaker.CreateToken(user.ID, nil, token.TypeAccess, time.Minute)
+				require.NoError(t, err)
+				return loginUserMFARequest{
+					MFAToken:            accessToken,
+					secondFactorRequest: secondFactorRequest{Code: mfaCode(t, mfa)},
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "MFA Not Enabled",
+			body: func(t *testing.T, tokenMaker token.Maker) loginUserMFARequest {
+				return loginUserMFARequest{
+					MFAToken:            createTestMFAToken(t, tokenMaker, user.ID),
+					secondFactorRequest: secondFactorRequest{Code: mfaCode(t, mfa)},
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusUnauthorized, "invalid_mfa_code")
+			},
+		},
+		{
+			name: "Bad Request",
+			body: func(t *testing.T, tokenMaker token.Maker) loginUserMFARequest {
+				return loginUserMFARequest{MFAToken: createTestMFAToken(t, tokenMaker, user.ID)}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestMFAServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := postJSON(t, server, "/users/login/mfa", v.body(t, server.tokenMaker))
+			v.checkResponse(t, server, recorder)
+		})
+	}
+}
+
+func TestLoginUserMFARateLimitApi(t *testing.T) {
+	user := randomUser()
+	mfa := randomMFA(t, user.ID)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestMFAServer(t, store)
+
+	store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+		Times(server.config.MFAAttemptLimit+1).
+		Return(mfa, nil)
+
+	body := loginUserMFARequest{
+		MFAToken:            createTestMFAToken(t, server.tokenMaker, user.ID),
+		secondFactorRequest: secondFactorRequest{Code: "000000"},
+	}
+	for i := 0; i < server.config.MFAAttemptLimit; i++ {
+		recorder := postJSON(t, server, "/users/login/mfa", body)
+		requireProblem(t, recorder, http.StatusUnauthorized, "invalid_mfa_code")
+	}
+
+	// the right code does not help once the limit is reached
+	body.Code = mfaCode(t, mfa)
+	recorder := postJSON(t, server, "/users/login/mfa", body)
+	requireProblem(t, recorder, http.StatusTooManyRequests, "rate_limited")
+	require.NotEmpty(t, recorder.Header().Get("Retry-After"))
+}
+
+func TestRegenerateRecoveryCodesApi(t *testing.T) {
+	user := randomUser()
+	mfa := randomMFA(t, user.ID)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestMFAServer(t, store)
+
+	gomock.InOrder(
+		store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+			Times(1).
+			Return(mfa, nil),
+		store.EXPECT().UseMFACode(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(int64(1), nil),
+		store.EXPECT().ReplaceMFARecoveryCodesTx(gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(_ interface{}, arg db.CreateMFARecoveryCodesParams) error {
+				require.Equal(t, user.ID, arg.UserID)
+				require.Len(t, arg.CodeHashes, recoveryCodeCount)
+				return nil
+			}),
+	)
+
+	path := fmt.Sprintf("/users/%s/mfa/recovery-codes", user.ID)
+	recorder := sendAuthorizedRequest(t, server, "POST", path, secondFactorRequest{Code: mfaCode(t, mfa)}, user.ID, []string{util.RoleUser})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	response := &recoveryCodesResponse{}
+	err := json.Unmarshal(recorder.Body.Bytes(), response)
+	require.NoError(t, err)
+	require.Len(t, response.RecoveryCodes, recoveryCodeCount)
+}
+
+func TestDisableMFAApi(t *testing.T) {
+	user := randomUser()
+	admin := randomUser()
+	mfa := randomMFA(t, user.ID)
+	pending := mfa
+	pending.ConfirmedAt = sql.NullTime{}
+
+	testCases := []struct {
+		name          string
+		body          interface{}
+		userID        uuid.UUID
+		roles         []string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Self With Code",
+			body:   secondFactorRequest{Code: mfaCode(t, mfa)},
+			userID: user.ID,
+			roles:  []string{util.RoleUser},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().UseMFACode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().DisableMFATx(gomock.Any(), gomock.Eq(db.DisableMFATxParams{UserID: user.ID, RevokeSessions: true})).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Self Without Code",
+			userID: user.ID,
+			roles:  []string{util.RoleUser},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().DisableMFATx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "Self Wrong Code",
+			body:   secondFactorRequest{Code: "000000"},
+			userID: user.ID,
+			roles:  []string{util.RoleUser},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().DisableMFATx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, "invalid_mfa_code")
+			},
+		},
+		{
+			name:   "Pending Enrollment",
+			userID: user.ID,
+			roles:  []string{util.RoleUser},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(pending, nil)
+				store.EXPECT().DisableMFATx(gomock.Any(), gomock.Eq(db.DisableMFATxParams{UserID: user.ID, RevokeSessions: false})).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Admin Reset",
+			userID: admin.ID,
+			roles:  []string{util.RoleUser, util.RoleAdmin},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().UseMFACode(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().DisableMFATx(gomock.Any(), gomock.Eq(db.DisableMFATxParams{UserID: user.ID, RevokeSessions: true})).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Other User",
+			userID: admin.ID,
+			roles:  []string{util.RoleUser},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "Internal Server Error",
+			userID: admin.ID,
+			roles:  []string{util.RoleUser, util.RoleAdmin},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(mfa, nil)
+				store.EXPECT().DisableMFATx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name:   "Not Enabled",
+			userID: user.ID,
+			roles:  []string{util.RoleUser},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusConflict, "mfa_not_enabled")
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestMFAServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := sendAuthorizedRequest(t, server, "DELETE", fmt.Sprintf("/users/%s/mfa", user.ID), v.body, v.userID, v.roles)
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+// createTestMFAToken returns MFA token which the user gets after entering the password
+func createTestMFAToken(t *testing.T, tokenMaker token.Maker, userID uuid.UUID) string {
+	mfaToken, _, err := tokenMaker.CreateToken(userID, nil, token.TypeMFA, time.Minute)
+	require.NoError(t, err)
+
+	return mfaToken
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	"github.com/rafdekar/user-api/token"
+	"strings"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+	authorizationPayloadKey = "authorization_payload"
+)
+
+// Codes of authentication errors
+const (
+	codeMissingAuthorization = "missing_authorization"
+	codeInvalidAuthorization = "invalid_authorization"
+	codeInvalidToken         = "invalid_token"
+	codeExpiredToken         = "expired_token"
+)
+
+// authMiddleware creates a gin middleware for authorization, it puts verified token payload into the context
+func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
+		if len(authorizationHeader) == 0 {
+			respondWithError(ctx, apperror.New(apperror.KindUnauthorized, codeMissingAuthorization, "authorization header is not provided"))
+			return
+		}
+
+		fields := strings.Fields(authorizationHeader)
+		if len(fields) != 2 {
+			respondWithError(ctx, apperror.New(apperror.KindUnauthorized, codeInvalidAuthorization, "invalid authorization header format"))
+			return
+		}
+
+		authorizationType := strings.ToLower(fields[0])
+		if authorizationType != authorizationTypeBearer {
+			respondWithError(ctx, apperror.Newf(apperror.KindUnauthorized, codeInvalidAuthorization, "unsupported authorization type %s", authorizationType))
+			return
+		}
+
+		payload, err := tokenMaker.VerifyToken(fields[1], token.TypeAccess)
+		if err != nil {
+			respondWithError(ctx, tokenError(err, apperror.KindUnauthorized))
+			return
+		}
+
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Next()
+	}
+}
+
+// authorizationPayload returns the payload put into the context by authMiddleware
+func authorizationPayload(ctx *gin.Context) *token.Payload {
+	return ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+}
+
+// tokenError converts error of token verification into domain error of given kind
+func tokenError(err error, kind apperror.Kind) *apperror.Error {
+	if errors.Is(err, token.ErrExpiredToken) {
+		return apperror.Wrap(err, kind, codeExpiredToken, "token has expired")
+	}
+
+	return apperror.Wrap(err, kind, codeInvalidToken, "token is invalid")
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/unicode/norm"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validation tags of first and last names, names are checked in NFC form which is also the form they are stored in
+const (
+	tagPersonalName = "personal_name"
+	tagNameLength   = "name_length"
+)
+
+// isNameSeparator reports whether the rune can join words of a name, e.g. in "O'Brien" or "Anne-Marie"
+func isNameSeparator(r rune) bool {
+	switch r {
+	case ' ', '\'', '-', '’', '‐':
+		return true
+	}
+
+	return false
+}
+
+// isPersonalName reports whether the name consists of words made of letters of any script and combining marks,
+// joined by single apostrophes, hyphens or spaces
+func isPersonalName(name string) bool {
+	afterSeparator := true
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+			afterSeparator = false
+		case unicode.Is(unicode.M, r):
+			// combining marks modify the preceding letter
+			if afterSeparator {
+				return false
+			}
+		case isNameSeparator(r):
+			if afterSeparator {
+				return false
+			}
+			afterSeparator = true
+		default:
+			return false
+		}
+	}
+
+	return !afterSeparator
+}
+
+// normalizeName converts the name into NFC, so that the same name typed on different keyboards is stored equally
+func normalizeName(name string) string {
+	return norm.NFC.String(name)
+}
+
+// validatePersonalName validates characters of the name
+func validatePersonalName(fl validator.FieldLevel) bool {
+	return isPersonalName(normalizeName(fl.Field().String()))
+}
+
+// nameLengthValidator validates that number of characters of the name is within the configured limits
+func nameLengthValidator(minLength int, maxLength int) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		length := utf8.RuneCountInString(normalizeName(fl.Field().String()))
+		return length >= minLength && length <= maxLength
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIsPersonalName(t *testing.T) {
+	valid := []string{
+		"José",
+		"José",
+		"O'Brien",
+		"O’Brien",
+		"Anne-Marie",
+		"Mary Ann",
+		"Łukasz",
+		"Nguyễn Văn",
+		"Ольга",
+		"山田",
+		"محمد",
+		"ʻOhana",
+	}
+	for _, name := range valid {
+		require.True(t, isPersonalName(normalizeName(name)), name)
+	}
+
+	invalid := []string{
+		"",
+		" ",
+		"R2D2",
+		"Anne--Marie",
+		"Mary  Ann",
+		" Mary",
+		"Mary ",
+		"-Anne",
+		"O'",
+		"́Jose",
+		"<script>",
+		"Anne_Marie",
+		"Mary\tAnn",
+	}
+	for _, name := range invalid {
+		require.False(t, isPersonalName(normalizeName(name)), name)
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	require.Equal(t, "José", normalizeName("José"))
+	require.Equal(t, "José", normalizeName("José"))
+}
+
+func TestNameLengthLimits(t *testing.T) {
+	for _, config := range []util.Config{
+		{NameMinLength: 0, NameMaxLength: 10},
+		{NameMinLength: 5, NameMaxLength: 4},
+	} {
+		_, err := NewServer(config, nil)
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/apperror"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCursorLimit is the page size used when limit is not given, the maximum is enforced by binding
+// of listUsersByCursorRequest
+const defaultCursorLimit = 20
+
+// Modes of counting users, estimated total is taken from table statistics and can be stale
+const (
+	countExact     = "exact"
+	countEstimated = "estimated"
+)
+
+// errInvalidCursor is returned when the cursor was not issued by this API or got corrupted
+var errInvalidCursor = &apperror.Error{
+	Kind:    apperror.KindInvalid,
+	Code:    "invalid_cursor",
+	Message: "cursor is invalid",
+	Fields:  []apperror.FieldError{{Field: "after", Code: "invalid_cursor", Message: "must be a next_cursor returned by the API"}},
+}
+
+// userCursor points at the last user of a page, users are listed in (created_at, id) order,
+// clients get it as an opaque string and must not depend on its content
+type userCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
+}
+
+// encodeUserCursor returns the cursor of the page which starts right after the user
+func encodeUserCursor(user db.User) string {
+	buffer, _ := json.Marshal(userCursor{CreatedAt: user.CreatedAt, ID: user.ID})
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
+
+// decodeUserCursor parses cursor returned by encodeUserCursor, empty cursor points before the first user
+func decodeUserCursor(cursor string) (userCursor, error) {
+	if cursor == "" {
+		return userCursor{}, nil
+	}
+
+	buffer, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return userCursor{}, errInvalidCursor
+	}
+
+	var decoded userCursor
+	if err := json.Unmarshal(buffer, &decoded); err != nil || decoded.ID == uuid.Nil || decoded.CreatedAt.IsZero() {
+		return userCursor{}, errInvalidCursor
+	}
+
+	return decoded, nil
+}
+
+// cursorPage is the envelope of a page of cursor pagination, NextCursor is null on the last page
+type cursorPage struct {
+	Items      []userResponse `json:"items"`
+	NextCursor *string        `json:"next_cursor"`
+}
+
+// newCursorPage builds the envelope from users fetched with limit+1 rows, the extra row only tells
+// that there is a next page and is not returned
+func newCursorPage(users []db.User, limit int32) cursorPage {
+	page := cursorPage{}
+	if int32(len(users)) > limit {
+		users = users[:limit]
+		nextCursor := encodeUserCursor(users[len(users)-1])
+		page.NextCursor = &nextCursor
+	}
+	page.Items = newUserListResponse(users)
+
+	return page
+}
+
+// offsetPage is the envelope of a page selected by page number, TotalEstimated tells that Total comes
+// from table statistics instead of counting the users
+type offsetPage struct {
+	Items          []userResponse `json:"items"`
+	Page           int32          `json:"page"`
+	PageSize       int32          `json:"page_size"`
+	Total          int64          `json:"total"`
+	TotalEstimated bool           `json:"total_estimated"`
+}
+
+// lastPage returns number of the last page, there is always at least one page even if it is empty
+func (p offsetPage) lastPage() int32 {
+	last := (p.Total + int64(p.PageSize) - 1) / int64(p.PageSize)
+	if last < 1 {
+		return 1
+	}
+
+	return int32(last)
+}
+
+// links returns RFC 8288 Link header value pointing to the first, previous, next and last page,
+// other query parameters of the request are kept
+func (p offsetPage) links(requestURL *url.URL) string {
+	link := func(page int32, rel string) string {
+		query := requestURL.Query()
+		query.Set("page_number", strconv.Itoa(int(page)))
+		query.Set("page_size", strconv.Itoa(int(p.PageSize)))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, requestURL.Path, query.Encode(), rel)
+	}
+
+	last := p.lastPage()
+	links := []string{link(1, "first")}
+	if p.Page > 1 {
+		prev := p.Page - 1
+		if prev > last {
+			prev = last
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if p.Page < last {
+		links = append(links, link(p.Page+1, "next"))
+	}
+	links = append(links, link(last, "last"))
+
+	return strings.Join(links, ", ")
+}
+
+// links returns RFC 8288 Link header value pointing to the first and the next page of cursor pagination,
+// limit is set explicitly since requests with only after parameter use the default one
+func (p cursorPage) links(requestURL *url.URL, limit int32) string {
+	link := func(after *string, rel string) string {
+		query := requestURL.Query()
+		query.Set("limit", strconv.Itoa(int(limit)))
+		query.Del("after")
+		if after != nil {
+			query.Set("after", *after)
+		}
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, requestURL.Path, query.Encode(), rel)
+	}
+
+	links := []string{link(nil, "first")}
+	if p.NextCursor != nil {
+		links = append(links, link(p.NextCursor, "next"))
+	}
+
+	return strings.Join(links, ", ")
+}
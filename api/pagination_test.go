@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/base64"
+	"github.com/google/uuid"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestUserCursor(t *testing.T) {
+	user := randomUser()
+	user.CreatedAt = time.Date(2022, 6, 15, 12, 30, 0, 123456000, time.UTC)
+
+	cursor, err := decodeUserCursor(encodeUserCursor(user))
+	require.NoError(t, err)
+	require.Equal(t, user.ID, cursor.ID)
+	require.True(t, user.CreatedAt.Equal(cursor.CreatedAt))
+
+	cursor, err = decodeUserCursor("")
+	require.NoError(t, err)
+	require.Equal(t, uuid.Nil, cursor.ID)
+
+	for _, invalid := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("[]")),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"c":"2022-06-15T12:30:00Z"}`)),
+	} {
+		_, err = decodeUserCursor(invalid)
+		require.ErrorIs(t, err, errInvalidCursor)
+	}
+}
+
+func TestNewCursorPage(t *testing.T) {
+	users := []db.User{randomUser(), randomUser(), randomUser()}
+
+	page := newCursorPage(users, 2)
+	require.Len(t, page.Items, 2)
+	require.NotNil(t, page.NextCursor)
+	require.Equal(t, encodeUserCursor(users[1]), *page.NextCursor)
+
+	page = newCursorPage(users, 3)
+	require.Len(t, page.Items, 3)
+	require.Nil(t, page.NextCursor)
+
+	page = newCursorPage([]db.User{}, 3)
+	require.NotNil(t, page.Items)
+	require.Empty(t, page.Items)
+}
+
+func TestOffsetPageLinks(t *testing.T) {
+	requestURL, err := url.Parse("/users?page_size=10&page_number=3&country=PL")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		page offsetPage
+		want string
+	}{
+		{
+			name: "Middle Page",
+			page: offsetPage{Page: 3, PageSize: 10, Total: 45},
+			want: `</users?country=PL&page_number=1&page_size=10>; rel="first", ` +
+				`</users?country=PL&page_number=2&page_size=10>; rel="prev", ` +
+				`</users?country=PL&page_number=4&page_size=10>; rel="next", ` +
+				`</users?country=PL&page_number=5&page_size=10>; rel="last"`,
+		},
+		{
+			name: "Only Page",
+			page: offsetPage{Page: 1, PageSize: 10, Total: 0},
+			want: `</users?country=PL&page_number=1&page_size=10>; rel="first", ` +
+				`</users?country=PL&page_number=1&page_size=10>; rel="last"`,
+		},
+		{
+			name: "Past Last Page",
+			page: offsetPage{Page: 9, PageSize: 10, Total: 20},
+			want: `</users?country=PL&page_number=1&page_size=10>; rel="first", ` +
+				`</users?country=PL&page_number=2&page_size=10>; rel="prev", ` +
+				`</users?country=PL&page_number=2&page_size=10>; rel="last"`,
+		},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			require.Equal(t, v.want, v.page.links(requestURL))
+		})
+	}
+}
+
+func TestCursorPageLinks(t *testing.T) {
+	requestURL, err := url.Parse("/users?after=abc&country=PL")
+	require.NoError(t, err)
+
+	next := "def"
+	page := cursorPage{NextCursor: &next}
+	require.Equal(t, `</users?country=PL&limit=20>; rel="first", `+
+		`</users?after=def&country=PL&limit=20>; rel="next"`, page.links(requestURL, 20))
+
+	page = cursorPage{}
+	require.Equal(t, `</users?country=PL&limit=20>; rel="first"`, page.links(requestURL, 20))
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/mail"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errInvalidResetToken does not tell unknown, used and expired tokens apart
+var errInvalidResetToken = apperror.New(apperror.KindInvalid, "invalid_reset_token", "password reset token is invalid or expired")
+
+// passwordResetEmailTimeout limits storing the token and sending the email, which run after the response is sent
+const passwordResetEmailTimeout = time.Minute
+
+// sendPasswordResetEmail creates a new password reset token for the user and mails the link with it
+func (s *Server) sendPasswordResetEmail(ctx context.Context, user db.User) error {
+	resetToken, err := newLinkToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.store.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		TokenHash: hashToken(resetToken),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(s.config.PasswordResetTokenDuration).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nsomeone asked to reset the password of your account. Open the link below to choose a new one, "+
+				"it expires in %s.\n\n%s\n\nIf it was not you, ignore this email and your password stays the same.\n",
+			user.FirstName, s.config.PasswordResetTokenDuration, tokenLink(s.config.PasswordResetURL, resetToken),
+		),
+	})
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// forgotPassword defines endpoint for requesting a password reset link, it responds with 202 whether the account
+// exists or not so that it can not be used to find out which addresses are registered
+func (s *Server) forgotPassword(ctx *gin.Context) {
+	if !allowRequest(ctx, s.passwordResetIPLimiter, ctx.ClientIP()) {
+		return
+	}
+
+	request := &forgotPasswordRequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	address := s.emails.Normalize(request.Email)
+	if !allowRequest(ctx, s.passwordResetEmailLimiter, strings.ToLower(address)) {
+		return
+	}
+
+	user, err := s.store.GetUserByEmail(ctx, address)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(ctx, err)
+		return
+	}
+
+	// the email is sent in the background and its failures are only logged, responding later or differently
+	// would reveal that the account exists
+	if err == nil {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), passwordResetEmailTimeout)
+			defer cancel()
+
+			if err := s.sendPasswordResetEmail(ctx, user); err != nil {
+				log.Printf("password reset email for user %s could not be sent: %v", user.ID, err)
+			}
+		}()
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{})
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// resetPassword defines endpoint for setting a new password with the token from reset link, all sessions
+// of the user are revoked since the old password may have been compromised
+func (s *Server) resetPassword(ctx *gin.Context) {
+	if !allowRequest(ctx, s.passwordResetIPLimiter, ctx.ClientIP()) {
+		return
+	}
+
+	request := &resetPasswordRequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(request.Password)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	// other links sent before would let whoever reads them change the password again and the old password
+	// may have been compromised, so the reset tokens and sessions go away together with it. Expiry of the token
+	// was set in UTC here, so it is compared with the time from here too rather than now() of the database session
+	_, err = s.store.ResetPasswordTx(ctx, db.ResetPasswordParams{
+		TokenHash: hashToken(request.Token),
+		Password:  hashedPassword,
+		ResetAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errInvalidResetToken)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
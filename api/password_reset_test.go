@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/rafdekar/user-api/apperror"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/mail"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postJSON sends the body as JSON to the server and returns the response
+func postJSON(t *testing.T, server *Server, path string, body interface{}) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("POST", path, bytes.NewBuffer(data))
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestForgotPasswordApi(t *testing.T) {
+	user := randomUser()
+
+	testCases := []struct {
+		name          string
+		body          forgotPasswordRequest
+		buildStubs    func(store *mockdb.MockStore, params *db.CreatePasswordResetTokenParams)
+		checkResponse func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreatePasswordResetTokenParams)
+	}{
+		{
+			name: "OK",
+			body: forgotPasswordRequest{Email: strings.ToUpper(user.Email)},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreatePasswordResetTokenParams) {
+				at := strings.LastIndex(user.Email, "@")
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Eq(strings.ToUpper(user.Email[:at])+user.Email[at:])).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().CreatePasswordResetToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.CreatePasswordResetTokenParams) (db.PasswordResetToken, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.WithinDuration(t, time.Now().Add(time.Hour), arg.ExpiresAt, time.Minute)
+						*params = arg
+						return db.PasswordResetToken{TokenHash: arg.TokenHash, UserID: arg.UserID}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreatePasswordResetTokenParams) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+
+				resetToken := requireTokenEmail(t, server, user.Email, server.config.PasswordResetURL)
+				require.Equal(t, hashToken(resetToken), params.TokenHash)
+			},
+		},
+		{
+			name: "Unknown Email",
+			body: forgotPasswordRequest{Email: user.Email},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreatePasswordResetTokenParams) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+				store.EXPECT().CreatePasswordResetToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreatePasswordResetTokenParams) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+				require.Empty(t, server.mailer.(*mail.MemoryMailer).Messages())
+			},
+		},
+		{
+			name: "Token Not Stored",
+			body: forgotPasswordRequest{Email: user.Email},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreatePasswordResetTokenParams) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().CreatePasswordResetToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.PasswordResetToken{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreatePasswordResetTokenParams) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+				require.Empty(t, server.mailer.(*mail.MemoryMailer).Messages())
+			},
+		},
+		{
+			name: "Bad Request",
+			body: forgotPasswordRequest{Email: util.RandomWord(10)},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreatePasswordResetTokenParams) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreatePasswordResetTokenParams) {
+				requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+			},
+		},
+		{
+			name: "Internal Server Error",
+			body: forgotPasswordRequest{Email: user.Email},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreatePasswordResetTokenParams) {
+				store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreatePasswordResetTokenParams) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			params := db.CreatePasswordResetTokenParams{}
+			v.buildStubs(store, &params)
+
+			recorder := postJSON(t, server, "/password/forgot", v.body)
+			server.background.Wait()
+
+			v.checkResponse(t, server, recorder, params)
+		})
+	}
+}
+
+func TestForgotPasswordRateLimitApi(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store)
+
+	// unknown addresses count against the limit too, otherwise the limit would reveal registered ones
+	store.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any()).
+		Times(server.config.PasswordResetEmailLimit+2).
+		Return(db.User{}, sql.ErrNoRows)
+
+	address := util.RandomEmail()
+	for i := 0; i < server.config.PasswordResetEmailLimit; i++ {
+		recorder := postJSON(t, server, "/password/forgot", forgotPasswordRequest{Email: address})
+		require.Equal(t, http.StatusAccepted, recorder.Code)
+	}
+
+	// spelling of the same address does not get around the limit
+	recorder := postJSON(t, server, "/password/forgot", forgotPasswordRequest{Email: strings.ToUpper(address)})
+	requireProblem(t, recorder, http.StatusTooManyRequests, "rate_limited")
+	require.NotEmpty(t, recorder.Header().Get("Retry-After"))
+
+	recorder = postJSON(t, server, "/password/forgot", forgotPasswordRequest{Email: util.RandomEmail()})
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	server.passwordResetIPLimiter = newRateLimiter(1, time.Hour)
+	recorder = postJSON(t, server, "/password/forgot", forgotPasswordRequest{Email: util.RandomEmail()})
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	recorder = postJSON(t, server, "/password/forgot", forgotPasswordRequest{Email: util.RandomEmail()})
+	requireProblem(t, recorder, http.StatusTooManyRequests, "rate_limited")
+}
+
+func TestResetPasswordApi(t *testing.T) {
+	user := randomUser()
+	resetToken, err := newLinkToken()
+	require.NoError(t, err)
+	newPassword := util.RandomWord(12)
+
+	testCases := []struct {
+		name          string
+		body          resetPasswordRequest
+		rateLimited   bool
+		buildStubs    func(store *mockdb.MockStore, server *Server)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: resetPasswordRequest{Token: resetToken, Password: newPassword},
+			buildStubs: func(store *mockdb.MockStore, server *Server) {
+				store.EXPECT().ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ResetPasswordParams) (db.User, error) {
+						require.Equal(t, hashToken(resetToken), arg.TokenHash)
+						require.NoError(t, server.hasher.Verify(arg.Password, newPassword))
+						require.WithinDuration(t, time.Now().UTC(), arg.ResetAt, time.Minute)
+						require.Equal(t, time.UTC, arg.ResetAt.Location())
+						return user, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid Token",
+			body: resetPasswordRequest{Token: resetToken, Password: newPassword},
+			buildStubs: func(store *mockdb.MockStore, server *Server) {
+				store.EXPECT().ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, "invalid_reset_token")
+			},
+		},
+		{
+			name: "Bad Request",
+			body: resetPasswordRequest{Token: resetToken},
+			buildStubs: func(store *mockdb.MockStore, server *Server) {
+				store.EXPECT().ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:        "Too Many Requests",
+			body:        resetPasswordRequest{Token: resetToken, Password: newPassword},
+			rateLimited: true,
+			buildStubs: func(store *mockdb.MockStore, server *Server) {
+				store.EXPECT().ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusTooManyRequests, "rate_limited")
+			},
+		},
+		{
+			name: "Internal Server Error",
+			body: resetPasswordRequest{Token: resetToken, Password: newPassword},
+			buildStubs: func(store *mockdb.MockStore, server *Server) {
+				store.EXPECT().ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+			if v.rateLimited {
+				server.passwordResetIPLimiter = newRateLimiter(0, time.Hour)
+			}
+
+			v.buildStubs(store, server)
+
+			recorder := postJSON(t, server, "/password/reset", v.body)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/rafdekar/user-api/apperror"
+	"github.com/rafdekar/user-api/country"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Media types of the supported patch documents
+const (
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// Codes of errors of applying a patch, statuses follow RFC 5789
+const (
+	codePatchTestFailed    = "patch_test_failed"
+	codeUnprocessablePatch = "unprocessable_patch"
+)
+
+// patchableUserFields lists members of the user document which can be changed with PATCH,
+// password can only be written, so it is not readable by JSON Patch "test" and "copy" operations
+var patchableUserFields = map[string]bool{
+	"first_name": true,
+	"last_name":  true,
+	"nickname":   true,
+	"password":   true,
+	"email":      true,
+	"country":    true,
+}
+
+// patchUserRequest keeps fields changed by a patch, nil fields are left untouched
+type patchUserRequest struct {
+	FirstName *string `json:"first_name" binding:"omitempty,personal_name,name_length"`
+	LastName  *string `json:"last_name" binding:"omitempty,personal_name,name_length"`
+	Nickname  *string `json:"nickname"`
+	Password  *string `json:"password"`
+	Email     *string `json:"email" binding:"omitempty,email"`
+	Country   *string `json:"country" binding:"omitempty,iso3166_alpha2"`
+}
+
+// patchUser method defines endpoint for partial update of the user with JSON Merge Patch (RFC 7396)
+// or JSON Patch (RFC 6902) document
+func (s *Server) patchUser(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !updateUserPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	contentType := ctx.ContentType()
+	if contentType != mediaTypeMergePatch && contentType != binding.MIMEJSON && contentType != mediaTypeJSONPatch {
+		ctx.Header("Accept-Patch", mediaTypeMergePatch+", "+mediaTypeJSONPatch)
+		respondWithError(ctx, apperror.Newf(apperror.KindUnsupportedMediaType, "unsupported_media_type",
+			"unsupported patch media type %q", contentType))
+		return
+	}
+
+	current, ok := s.matchedUser(ctx, id, true)
+	if !ok {
+		return
+	}
+
+	request := &patchUserRequest{}
+	if contentType == mediaTypeJSONPatch {
+		err = applyJSONPatch(body, current, request)
+	} else {
+		err = applyMergePatch(body, request)
+	}
+	if err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	if err := binding.Validator.ValidateStruct(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+	for _, name := range []*string{request.FirstName, request.LastName} {
+		if name != nil {
+			*name = normalizeName(*name)
+		}
+	}
+	if request.Email != nil {
+		normalized := s.emails.Normalize(*request.Email)
+		request.Email = &normalized
+	}
+	if request.Country != nil {
+		normalized := country.Normalize(*request.Country)
+		request.Country = &normalized
+	}
+
+	params := db.PatchUserParams{
+		ID:        id,
+		FirstName: nullString(request.FirstName),
+		LastName:  nullString(request.LastName),
+		Nickname:  nullString(request.Nickname),
+		Email:     nullString(request.Email),
+		Country:   nullString(request.Country),
+		Version:   current.Version,
+	}
+
+	if request.Password != nil {
+		hashedPassword, err := s.hasher.Hash(*request.Password)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		params.Password = nullString(&hashedPassword)
+	}
+
+	user, err := s.store.PatchUser(ctx, params)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errPreconditionFailed)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	setUserCacheHeaders(ctx, user)
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// applyMergePatch reads JSON Merge Patch document into request, since all user fields are required
+// removing them with null is rejected
+func applyMergePatch(body []byte, request *patchUserRequest) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+	if fields == nil {
+		return apperror.New(apperror.KindInvalid, apperror.CodeMalformedRequest, "merge patch has to be a JSON object")
+	}
+
+	for name, value := range fields {
+		if !patchableUserFields[name] {
+			return unprocessablePatch("unknown field %q", name)
+		}
+		if isJSONNull(value) {
+			return unprocessablePatch("field %q can not be removed", name)
+		}
+	}
+
+	return json.Unmarshal(body, request)
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies JSON Patch operations to the user document and reads changed fields into request,
+// "add", "replace", "test" and "copy" operations are supported, "remove" and "move" would leave required
+// fields empty
+func applyJSONPatch(body []byte, user db.User, request *patchUserRequest) error {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(body, &operations); err != nil {
+		return err
+	}
+
+	document, err := newPatchDocument(user)
+	if err != nil {
+		return err
+	}
+	original, err := newPatchDocument(user)
+	if err != nil {
+		return err
+	}
+
+	for i, operation := range operations {
+		field, ok := jsonPatchField(operation.Path)
+		if !ok {
+			return unprocessablePatch("operation %d, unsupported path %q", i, operation.Path)
+		}
+
+		switch operation.Op {
+		case "add", "replace":
+			if operation.Value == nil || isJSONNull(operation.Value) {
+				return unprocessablePatch("operation %d has no value", i)
+			}
+			document[field] = operation.Value
+		case "test":
+			current, ok := document[field]
+			if !ok {
+				return unprocessablePatch("operation %d can not test %q", i, operation.Path)
+			}
+			if !jsonEqual(current, operation.Value) {
+				return apperror.Newf(apperror.KindConflict, codePatchTestFailed, "operation %d, %q has different value", i, operation.Path)
+			}
+		case "copy":
+			from, ok := jsonPatchField(operation.From)
+			if !ok {
+				return unprocessablePatch("operation %d, unsupported path %q", i, operation.From)
+			}
+			value, ok := document[from]
+			if !ok {
+				return unprocessablePatch("operation %d can not copy %q", i, operation.From)
+			}
+			document[field] = value
+		case "remove", "move":
+			return unprocessablePatch("operation %d, field %q can not be removed", i, operation.Path)
+		default:
+			return unprocessablePatch("operation %d, unsupported op %q", i, operation.Op)
+		}
+	}
+
+	changed := map[string]json.RawMessage{}
+	for name, value := range document {
+		if !jsonEqual(value, original[name]) {
+			changed[name] = value
+		}
+	}
+
+	buffer, err := json.Marshal(changed)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buffer, request)
+}
+
+// newPatchDocument builds the JSON document which JSON Patch operations are applied to
+func newPatchDocument(user db.User) (map[string]json.RawMessage, error) {
+	buffer, err := json.Marshal(newUserResponse(user))
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buffer, &fields); err != nil {
+		return nil, err
+	}
+
+	document := map[string]json.RawMessage{}
+	for name, value := range fields {
+		if patchableUserFields[name] {
+			document[name] = value
+		}
+	}
+
+	return document, nil
+}
+
+// jsonPatchField returns name of the patchable field pointed by JSON Pointer, only top level members are supported
+func jsonPatchField(pointer string) (string, bool) {
+	field := strings.TrimPrefix(pointer, "/")
+	if !strings.HasPrefix(pointer, "/") || !patchableUserFields[field] {
+		return "", false
+	}
+
+	return field, true
+}
+
+// isJSONNull checks if the raw JSON value is null
+func isJSONNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+// jsonEqual compares JSON values ignoring their formatting
+func jsonEqual(a json.RawMessage, b json.RawMessage) bool {
+	var valueA, valueB interface{}
+	if json.Unmarshal(a, &valueA) != nil || json.Unmarshal(b, &valueB) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(valueA, valueB)
+}
+
+// unprocessablePatch returns error of a well-formed patch which can not be applied to the user
+func unprocessablePatch(format string, args ...interface{}) error {
+	return apperror.Newf(apperror.KindUnprocessable, codeUnprocessablePatch, format, args...)
+}
+
+// nullString converts optional value to sql.NullString, nil becomes NULL
+func nullString(value *string) sql.NullString {
+	if value == nil {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: *value, Valid: true}
+}
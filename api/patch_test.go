@@ -0,0 +1,375 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/password"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPatchUserApi(t *testing.T) {
+	user := randomUser()
+	newFirstName := util.RandomWord(10)
+	newPassword := util.RandomWord(10)
+
+	testCases := []struct {
+		name        string
+		contentType string
+		body        string
+		// ifMatch defaults to the entity tag of user, "-" sends the request without If-Match header
+		ifMatch       string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "Merge Patch",
+			contentType: mediaTypeMergePatch,
+			body:        `{"first_name": "` + newFirstName + `"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				params := db.PatchUserParams{
+					ID:        user.ID,
+					Version:   user.Version,
+					FirstName: sql.NullString{String: newFirstName, Valid: true},
+				}
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchUser(t, recorder.Body, &user)
+			},
+		},
+		{
+			name:        "Merge Patch Lower Case Country",
+			contentType: mediaTypeMergePatch,
+			body:        `{"country": "de"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				params := db.PatchUserParams{
+					ID:      user.ID,
+					Version: user.Version,
+					Country: sql.NullString{String: "DE", Valid: true},
+				}
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:        "Merge Patch Password",
+			contentType: mediaTypeMergePatch,
+			body:        `{"password": "` + newPassword + `"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.PatchUserParams) (db.User, error) {
+						require.False(t, arg.FirstName.Valid)
+						require.True(t, arg.Password.Valid)
+
+						hasher, err := password.NewBcryptHasher(bcrypt.MinCost)
+						require.NoError(t, err)
+						require.NoError(t, hasher.Verify(arg.Password.String, newPassword))
+						return user, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:        "Merge Patch Removing Field",
+			contentType: mediaTypeMergePatch,
+			body:        `{"first_name": null}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name:        "Merge Patch Unknown Field",
+			contentType: mediaTypeMergePatch,
+			body:        `{"id": "` + uuid.New().String() + `"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name:        "Merge Patch Invalid Value",
+			contentType: mediaTypeMergePatch,
+			body:        `{"country": "POL"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:        "Merge Patch Malformed",
+			contentType: mediaTypeMergePatch,
+			body:        `[]`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:        "JSON Patch",
+			contentType: mediaTypeJSONPatch,
+			body: `[
+				{"op": "test", "path": "/last_name", "value": "` + user.LastName + `"},
+				{"op": "replace", "path": "/first_name", "value": "` + newFirstName + `"},
+				{"op": "copy", "from": "/first_name", "path": "/last_name"},
+				{"op": "replace", "path": "/country", "value": "` + user.Country + `"}
+			]`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+
+				params := db.PatchUserParams{
+					ID:        user.ID,
+					Version:   user.Version,
+					FirstName: sql.NullString{String: newFirstName, Valid: true},
+					LastName:  sql.NullString{String: newFirstName, Valid: true},
+				}
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:        "JSON Patch Failed Test",
+			contentType: mediaTypeJSONPatch,
+			body:        `[{"op": "test", "path": "/nickname", "value": "` + util.RandomWord(12) + `"}]`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name:        "JSON Patch Remove",
+			contentType: mediaTypeJSONPatch,
+			body:        `[{"op": "remove", "path": "/nickname"}]`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name:        "JSON Patch Test Password",
+			contentType: mediaTypeJSONPatch,
+			body:        `[{"op": "test", "path": "/password", "value": "` + user.Password + `"}]`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name:        "JSON Patch Not Found",
+			contentType: mediaTypeJSONPatch,
+			body:        `[{"op": "replace", "path": "/first_name", "value": "` + newFirstName + `"}]`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:        "Unsupported Media Type",
+			contentType: "text/plain",
+			body:        `first_name=` + newFirstName,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+				require.Contains(t, recorder.Header().Get("Accept-Patch"), mediaTypeMergePatch)
+			},
+		},
+		{
+			name:        "Forbidden",
+			contentType: mediaTypeMergePatch,
+			body:        `{"first_name": "` + newFirstName + `"}`,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:        "Concurrent Update",
+			contentType: mediaTypeMergePatch,
+			body:        `{"first_name": "` + newFirstName + `"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionFailed, "precondition_failed")
+			},
+		},
+		{
+			name:        "Internal Server Error",
+			contentType: mediaTypeMergePatch,
+			body:        `{"first_name": "` + newFirstName + `"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name:        "Precondition Required",
+			contentType: mediaTypeMergePatch,
+			body:        `{"first_name": "` + newFirstName + `"}`,
+			ifMatch:     "-",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionRequired, "precondition_required")
+			},
+		},
+		{
+			name:        "Precondition Failed",
+			contentType: mediaTypeMergePatch,
+			body:        `{"first_name": "` + newFirstName + `"}`,
+			ifMatch:     `"stale"`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().PatchUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionFailed, "precondition_failed")
+				require.Equal(t, userETag(user), recorder.Header().Get("ETag"))
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("PATCH", "/users/"+user.ID.String(), bytes.NewBufferString(v.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", v.contentType)
+			switch v.ifMatch {
+			case "":
+				req.Header.Set("If-Match", userETag(user))
+			case "-":
+			default:
+				req.Header.Set("If-Match", v.ifMatch)
+			}
+
+			if v.setupAuth != nil {
+				v.setupAuth(t, req, server.tokenMaker)
+			} else {
+				addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			}
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
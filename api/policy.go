@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/apperror"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/util"
+)
+
+// permission is an action which roles can be allowed to perform
+type permission string
+
+const (
+	permissionListUsers     permission = "users:list"
+	permissionReadAnyUser   permission = "users:read:any"
+	permissionUpdateAnyUser permission = "users:update:any"
+	permissionDeleteAnyUser permission = "users:delete:any"
+	permissionListDeleted   permission = "users:list:deleted"
+	permissionRestoreUser   permission = "users:restore"
+	permissionSearchUsers   permission = "users:search"
+	permissionResetMFA      permission = "users:mfa:reset"
+	permissionUnlockUser    permission = "users:unlock"
+)
+
+// mfaRequiredRoles are granted only to sessions which were authenticated with the second factor, so administrators
+// have to enroll MFA before they can use their role
+var mfaRequiredRoles = map[string]bool{
+	util.RoleAdmin: true,
+}
+
+// rolePermissions maps roles stored in the database to permissions they grant
+var rolePermissions = map[string][]permission{
+	util.RoleUser: {},
+	util.RoleAdmin: {
+		permissionListUsers,
+		permissionReadAnyUser,
+		permissionUpdateAnyUser,
+		permissionDeleteAnyUser,
+		permissionListDeleted,
+		permissionRestoreUser,
+		permissionSearchUsers,
+		permissionResetMFA,
+		permissionUnlockUser,
+	},
+	util.RoleSupport: {
+		permissionSearchUsers,
+	},
+}
+
+// policy describes who is allowed to call a route
+type policy struct {
+	// permission which has to be granted by one of the caller roles
+	permission permission
+	// allowSelf lets callers act on their own account without holding the permission
+	allowSelf bool
+}
+
+// Policies of the user routes, createUser has none since signing up does not require authentication
+var (
+	listUsersPolicy  = policy{permission: permissionListUsers}
+	getUserPolicy    = policy{permission: permissionReadAnyUser, allowSelf: true}
+	updateUserPolicy = policy{permission: permissionUpdateAnyUser, allowSelf: true}
+	deleteUserPolicy = policy{permission: permissionDeleteAnyUser, allowSelf: true}
+	// deleted accounts can not log in, so only administrators can list and restore them
+	listDeletedUsersPolicy = policy{permission: permissionListDeleted}
+	restoreUserPolicy      = policy{permission: permissionRestoreUser}
+	searchUsersPolicy      = policy{permission: permissionSearchUsers}
+	// administrators can reset MFA of users who lost their authenticator, enrolling is up to the users themselves
+	getMFAPolicy     = policy{permission: permissionResetMFA, allowSelf: true}
+	disableMFAPolicy = policy{permission: permissionResetMFA, allowSelf: true}
+	enrollMFAPolicy  = policy{allowSelf: true}
+	// locks protect accounts against guessing their passwords, so only administrators can lift them
+	lockoutPolicy = policy{permission: permissionUnlockUser}
+	// verification is sent to the address of the account, so whoever can change it can also request the email
+	sendEmailVerificationPolicy = policy{permission: permissionUpdateAnyUser, allowSelf: true}
+)
+
+var errForbidden = apperror.New(apperror.KindForbidden, "forbidden", "user is not allowed to perform this action")
+
+// allows checks if the authenticated caller can perform the action on account of user with given ID,
+// uuid.Nil means that the action does not target any specific account
+func (p policy) allows(payload *token.Payload, userID uuid.UUID) bool {
+	if payload == nil {
+		return false
+	}
+
+	if p.allowSelf && userID != uuid.Nil && payload.UserID == userID {
+		return true
+	}
+
+	return hasPermission(payload.Roles, p.permission)
+}
+
+// hasPermission checks if any of the roles grants the permission
+func hasPermission(roles []string, perm permission) bool {
+	for _, role := range roles {
+		for _, v := range rolePermissions[role] {
+			if v == perm {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// authorize creates a gin middleware enforcing policy of routes which do not target a specific account,
+// it has to be used after authMiddleware
+func authorize(p policy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !p.allows(authorizationPayload(ctx), uuid.Nil) {
+			respondWithError(ctx, errForbidden)
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// withoutMFARoles drops roles which require the second factor unless the session was authenticated with it
+func withoutMFARoles(roles []string, mfaAuthenticated bool) []string {
+	if mfaAuthenticated {
+		return roles
+	}
+
+	result := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if !mfaRequiredRoles[role] {
+			result = append(result, role)
+		}
+	}
+
+	return result
+}
+
+// userRoles returns all roles of the user, every registered user implicitly holds the user role
+// and user_roles keeps only the additional grants
+func (s *Server) userRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	storedRoles, err := s.store.ListUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{util.RoleUser}, storedRoles...), nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	userID := uuid.New()
+	otherID := uuid.New()
+
+	user := &token.Payload{UserID: userID, Roles: []string{util.RoleUser}}
+	admin := &token.Payload{UserID: uuid.New(), Roles: []string{util.RoleUser, util.RoleAdmin}}
+
+	require.True(t, updateUserPolicy.allows(user, userID))
+	require.False(t, updateUserPolicy.allows(user, otherID))
+	require.True(t, updateUserPolicy.allows(admin, otherID))
+
+	require.True(t, deleteUserPolicy.allows(user, userID))
+	require.False(t, deleteUserPolicy.allows(user, otherID))
+	require.True(t, deleteUserPolicy.allows(admin, otherID))
+
+	require.False(t, listUsersPolicy.allows(user, uuid.Nil))
+	require.True(t, listUsersPolicy.allows(admin, uuid.Nil))
+
+	require.False(t, updateUserPolicy.allows(nil, userID))
+	require.False(t, updateUserPolicy.allows(&token.Payload{UserID: userID, Roles: []string{"unknown"}}, otherID))
+}
+
+func TestWithoutMFARoles(t *testing.T) {
+	roles := []string{util.RoleUser, util.RoleAdmin}
+
+	require.Equal(t, roles, withoutMFARoles(roles, true))
+	require.Equal(t, []string{util.RoleUser}, withoutMFARoles(roles, false))
+	require.Empty(t, withoutMFARoles(nil, false))
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	"net/http"
+)
+
+// mediaTypeProblem is the media type of error responses described by RFC 7807
+const mediaTypeProblem = "application/problem+json"
+
+// problemTypeDefault is used as problem type since error codes are returned in the code extension member
+const problemTypeDefault = "about:blank"
+
+// kindStatuses maps kinds of domain errors to HTTP statuses
+var kindStatuses = map[apperror.Kind]int{
+	apperror.KindInvalid:              http.StatusBadRequest,
+	apperror.KindUnauthorized:         http.StatusUnauthorized,
+	apperror.KindForbidden:            http.StatusForbidden,
+	apperror.KindNotFound:             http.StatusNotFound,
+	apperror.KindConflict:             http.StatusConflict,
+	apperror.KindPreconditionFailed:   http.StatusPreconditionFailed,
+	apperror.KindPreconditionRequired: http.StatusPreconditionRequired,
+	apperror.KindUnprocessable:        http.StatusUnprocessableEntity,
+	apperror.KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	apperror.KindTooManyRequests:      http.StatusTooManyRequests,
+	apperror.KindInternal:             http.StatusInternalServerError,
+}
+
+// problemResponse is the problem details object, Code and Errors are its extension members
+type problemResponse struct {
+	Type     string                `json:"type"`
+	Title    string                `json:"title"`
+	Status   int                   `json:"status"`
+	Detail   string                `json:"detail,omitempty"`
+	Instance string                `json:"instance,omitempty"`
+	Code     string                `json:"code"`
+	Errors   []apperror.FieldError `json:"errors,omitempty"`
+}
+
+// respondWithError classifies the error and aborts the request with problem+json response,
+// causes of the errors are attached to the context for logging and never sent to the client
+func respondWithError(ctx *gin.Context, err error) {
+	appErr := apperror.Classify(err)
+
+	status, ok := kindStatuses[appErr.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	if appErr.Err != nil || status == http.StatusInternalServerError {
+		_ = ctx.Error(err)
+	}
+
+	problem := problemResponse{
+		Type:     problemTypeDefault,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   appErr.Message,
+		Instance: ctx.Request.URL.Path,
+		Code:     appErr.Code,
+		Errors:   appErr.Fields,
+	}
+
+	ctx.Header("Content-Type", mediaTypeProblem)
+	ctx.AbortWithStatusJSON(status, problem)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// requireProblem checks that the response is a problem+json document with given status and code
+func requireProblem(t *testing.T, recorder *httptest.ResponseRecorder, status int, code string) problemResponse {
+	require.Equal(t, status, recorder.Code)
+	require.Equal(t, mediaTypeProblem, recorder.Header().Get("Content-Type"))
+
+	var problem problemResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &problem)
+	require.NoError(t, err)
+	require.Equal(t, problemTypeDefault, problem.Type)
+	require.Equal(t, http.StatusText(status), problem.Title)
+	require.Equal(t, status, problem.Status)
+	require.Equal(t, code, problem.Code)
+	require.NotEmpty(t, problem.Detail)
+
+	return problem
+}
+
+func TestRespondWithError(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{
+			name:   "Domain Error",
+			err:    errForbidden,
+			status: http.StatusForbidden,
+			code:   "forbidden",
+		},
+		{
+			name:   "Unsupported Media Type",
+			err:    apperror.New(apperror.KindUnsupportedMediaType, "unsupported_media_type", "unsupported media type"),
+			status: http.StatusUnsupportedMediaType,
+			code:   "unsupported_media_type",
+		},
+		{
+			name:   "Too Many Requests",
+			err:    apperror.New(apperror.KindTooManyRequests, "rate_limited", "too many requests"),
+			status: http.StatusTooManyRequests,
+			code:   "rate_limited",
+		},
+		{
+			name:   "Unknown Error",
+			err:    errors.New("secret connection string"),
+			status: http.StatusInternalServerError,
+			code:   apperror.CodeInternal,
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest("GET", "/users/1", nil)
+
+			respondWithError(ctx, v.err)
+
+			problem := requireProblem(t, recorder, v.status, v.code)
+			require.Equal(t, "/users/1", problem.Instance)
+			require.NotContains(t, recorder.Body.String(), "secret")
+			require.True(t, ctx.IsAborted())
+		})
+	}
+}
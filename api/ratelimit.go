@@ -0,0 +1,96 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errRateLimited = apperror.New(apperror.KindTooManyRequests, "rate_limited", "too many requests, try again later")
+
+// rateWindow counts requests of a single key since start
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter allows at most limit requests of every key in fixed windows, its state is kept in memory
+// so every instance of the server limits requests on its own
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	// now returns the current time, tests replace it to move the clock
+	now func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]rateWindow
+	lastSweep time.Time
+}
+
+// newRateLimiter creates a new rateLimiter
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		windows: make(map[string]rateWindow),
+	}
+}
+
+// allow records a request of the key and reports whether it is within the limit, rejected requests are
+// counted too and retryAfter tells how long until the window of the key ends
+func (l *rateLimiter) allow(key string) (allowed bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	current, ok := l.windows[key]
+	if !ok || now.Sub(current.start) >= l.window {
+		current = rateWindow{start: now}
+	}
+	current.count++
+	l.windows[key] = current
+
+	if current.count > l.limit {
+		return false, current.start.Add(l.window).Sub(now)
+	}
+
+	return true, 0
+}
+
+// sweep forgets windows which ended, it runs at most once per window so that the map does not grow
+// with keys which are never seen again
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+
+	for key, v := range l.windows {
+		if now.Sub(v.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// allowRequest checks the limit of the key, it responds with 429 and Retry-After header and returns false
+// when the request is over the limit
+func allowRequest(ctx *gin.Context, limiter *rateLimiter, key string) bool {
+	allowed, retryAfter := limiter.allow(key)
+	if !allowed {
+		setRetryAfter(ctx, retryAfter)
+		respondWithError(ctx, errRateLimited)
+	}
+
+	return allowed
+}
+
+// setRetryAfter tells clients in whole seconds how long to wait before trying again
+func setRetryAfter(ctx *gin.Context, retryAfter time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock of rateLimiter which moves only when told to
+type fakeClock struct {
+	current time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.current
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.current = c.current.Add(d)
+}
+
+func newTestRateLimiter(limit int, window time.Duration) (*rateLimiter, *fakeClock) {
+	clock := &fakeClock{current: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(limit, window)
+	limiter.now = clock.now
+
+	return limiter, clock
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter, clock := newTestRateLimiter(2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := limiter.allow("a")
+		require.True(t, allowed)
+	}
+
+	clock.advance(15 * time.Second)
+	allowed, retryAfter := limiter.allow("a")
+	require.False(t, allowed)
+	require.Equal(t, 45*time.Second, retryAfter)
+
+	// keys are limited independently
+	allowed, _ = limiter.allow("b")
+	require.True(t, allowed)
+
+	clock.advance(45 * time.Second)
+	allowed, _ = limiter.allow("a")
+	require.True(t, allowed)
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter, clock := newTestRateLimiter(1, time.Minute)
+
+	limiter.allow("a")
+	clock.advance(30 * time.Second)
+	limiter.allow("b")
+	require.Len(t, limiter.windows, 2)
+
+	clock.advance(30 * time.Second)
+	limiter.allow("c")
+	require.Len(t, limiter.windows, 2)
+	require.NotContains(t, limiter.windows, "a")
+}
+
+func TestAllowRequest(t *testing.T) {
+	limiter, clock := newTestRateLimiter(1, time.Minute)
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest("POST", "/password/forgot", nil)
+	require.True(t, allowRequest(ctx, limiter, "a"))
+	require.False(t, ctx.IsAborted())
+
+	clock.advance(500 * time.Millisecond)
+	recorder = httptest.NewRecorder()
+	ctx, _ = gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest("POST", "/password/forgot", nil)
+	require.False(t, allowRequest(ctx, limiter, "a"))
+
+	requireProblem(t, recorder, http.StatusTooManyRequests, "rate_limited")
+	require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/google/uuid"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"time"
+)
+
+// userResponse is the wire representation of a user, only fields listed here are ever sent to clients
+type userResponse struct {
+	ID         uuid.UUID `json:"id"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+	Nickname   string    `json:"nickname"`
+	Email      string    `json:"email"`
+	Country    string    `json:"country"`
+	ModifiedAt time.Time `json:"modified_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	// EmailVerifiedAt is set once the user proves they own the address, changing the address unsets it
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// DeletedAt is set only for soft-deleted users, which are listed to administrators on request
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// newUserResponse projects db.User onto userResponse
+func newUserResponse(user db.User) userResponse {
+	response := userResponse{
+		ID:         user.ID,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		Nickname:   user.Nickname,
+		Email:      user.Email,
+		Country:    user.Country,
+		ModifiedAt: user.ModifiedAt,
+		CreatedAt:  user.CreatedAt,
+	}
+	if user.EmailVerifiedAt.Valid {
+		response.EmailVerifiedAt = &user.EmailVerifiedAt.Time
+	}
+	if user.DeletedAt.Valid {
+		response.DeletedAt = &user.DeletedAt.Time
+	}
+
+	return response
+}
+
+// newUserListResponse projects every db.User from the list onto userResponse
+func newUserListResponse(users []db.User) []userResponse {
+	response := make([]userResponse, len(users))
+	for i, user := range users {
+		response[i] = newUserResponse(user)
+	}
+
+	return response
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// defaultSearchLimit is the number of results returned when limit is not given
+const defaultSearchLimit = 20
+
+// Delimiters of matches in headlines returned by SearchUsers, they are private use characters so that they
+// can not be confused with the markup
+const (
+	headlineStart = "\ue000"
+	headlineStop  = "\ue001"
+)
+
+type searchUsersRequest struct {
+	Query string `form:"q" binding:"required,max=255"`
+	Limit int32  `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// userSearchResult is a user found by searchUsers, Highlights maps names of the matched fields
+// to their HTML escaped values with matches wrapped in <mark> elements
+type userSearchResult struct {
+	userResponse
+	Rank       float32           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// searchUsers defines endpoint for full-text and fuzzy search over names, nicknames and emails of users,
+// results are ordered from the best match
+func (s *Server) searchUsers(ctx *gin.Context) {
+	request := &searchUsersRequest{}
+	if err := ctx.ShouldBindQuery(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+	if request.Limit == 0 {
+		request.Limit = defaultSearchLimit
+	}
+
+	rows, err := s.store.SearchUsers(ctx, db.SearchUsersParams{
+		Query:    request.Query,
+		RowLimit: request.Limit,
+	})
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	response := make([]userSearchResult, len(rows))
+	for i, row := range rows {
+		response[i] = newUserSearchResult(row)
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// newUserSearchResult projects db.SearchUsersRow onto userSearchResult
+func newUserSearchResult(row db.SearchUsersRow) userSearchResult {
+	result := userSearchResult{
+		userResponse: newUserResponse(db.User{
+			ID:         row.ID,
+			FirstName:  row.FirstName,
+			LastName:   row.LastName,
+			Nickname:   row.Nickname,
+			Email:      row.Email,
+			Country:    row.Country,
+			ModifiedAt: row.ModifiedAt,
+			CreatedAt:  row.CreatedAt,
+			DeletedAt:  row.DeletedAt,
+			Version:    row.Version,
+		}),
+		Rank:       row.Rank,
+		Highlights: map[string]string{},
+	}
+
+	fields := []struct {
+		name     string
+		value    string
+		headline string
+		similar  bool
+	}{
+		{"first_name", row.FirstName, row.FirstNameHeadline, row.FirstNameSimilar},
+		{"last_name", row.LastName, row.LastNameHeadline, row.LastNameSimilar},
+		{"nickname", row.Nickname, row.NicknameHeadline, row.NicknameSimilar},
+		{"email", row.Email, row.EmailHeadline, row.EmailSimilar},
+	}
+	for _, field := range fields {
+		if highlighted, ok := highlight(field.value, field.headline, field.similar); ok {
+			result.Highlights[field.name] = highlighted
+		}
+	}
+
+	return result
+}
+
+// highlight marks matches of the full-text search found in the headline, fields which only resemble
+// the query are marked as a whole since similarity does not tell which part of them matched
+func highlight(value string, headline string, similar bool) (string, bool) {
+	if strings.Contains(headline, headlineStart) {
+		escaped := html.EscapeString(headline)
+		escaped = strings.ReplaceAll(escaped, headlineStart, "<mark>")
+		escaped = strings.ReplaceAll(escaped, headlineStop, "</mark>")
+		return escaped, true
+	}
+
+	if similar {
+		return "<mark>" + html.EscapeString(value) + "</mark>", true
+	}
+
+	return "", false
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/apperror"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func randomSearchUsersRow() db.SearchUsersRow {
+	user := randomUser()
+	return db.SearchUsersRow{
+		ID:                user.ID,
+		FirstName:         user.FirstName,
+		LastName:          user.LastName,
+		Nickname:          user.Nickname,
+		Email:             user.Email,
+		Country:           user.Country,
+		ModifiedAt:        user.ModifiedAt,
+		CreatedAt:         user.CreatedAt,
+		Version:           user.Version,
+		Rank:              0.5,
+		FirstNameHeadline: headlineStart + user.FirstName + headlineStop,
+		LastNameHeadline:  user.LastName,
+		NicknameHeadline:  user.Nickname,
+		EmailHeadline:     user.Email,
+		NicknameSimilar:   true,
+	}
+}
+
+func TestSearchUsersApi(t *testing.T) {
+	row := randomSearchUsersRow()
+
+	testCases := []struct {
+		name          string
+		query         string
+		roles         []string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "q=" + row.FirstName,
+			roles: []string{util.RoleUser, util.RoleSupport},
+			buildStubs: func(store *mockdb.MockStore) {
+				params := db.SearchUsersParams{Query: row.FirstName, RowLimit: defaultSearchLimit}
+				store.EXPECT().SearchUsers(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return([]db.SearchUsersRow{row}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), "password")
+
+				var response []userSearchResult
+				err := json.Unmarshal(recorder.Body.Bytes(), &response)
+				require.NoError(t, err)
+				require.Len(t, response, 1)
+				require.Equal(t, row.ID, response[0].ID)
+				require.Equal(t, row.Rank, response[0].Rank)
+				require.Equal(t, map[string]string{
+					"first_name": "<mark>" + row.FirstName + "</mark>",
+					"nickname":   "<mark>" + row.Nickname + "</mark>",
+				}, response[0].Highlights)
+			},
+		},
+		{
+			name:  "Limit",
+			query: "q=smith&limit=5",
+			roles: []string{util.RoleUser, util.RoleAdmin},
+			buildStubs: func(store *mockdb.MockStore) {
+				params := db.SearchUsersParams{Query: "smith", RowLimit: 5}
+				store.EXPECT().SearchUsers(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return([]db.SearchUsersRow{}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, "[]", recorder.Body.String())
+			},
+		},
+		{
+			name:  "Missing Query",
+			query: "limit=5",
+			roles: []string{util.RoleUser, util.RoleAdmin},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().SearchUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Equal(t, "q", problem.Errors[0].Field)
+			},
+		},
+		{
+			name:  "Forbidden",
+			query: "q=smith",
+			roles: []string{util.RoleUser},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().SearchUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:  "Internal Server Error",
+			query: "q=smith",
+			roles: []string{util.RoleUser, util.RoleAdmin},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().SearchUsers(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("GET", "/users/search?"+v.query, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, uuid.New(), v.roles, time.Minute)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	testCases := []struct {
+		name        string
+		value       string
+		headline    string
+		similar     bool
+		want        string
+		highlighted bool
+	}{
+		{
+			name:        "Full-Text Match",
+			value:       "john@example.com",
+			headline:    headlineStart + "john@example.com" + headlineStop,
+			want:        "<mark>john@example.com</mark>",
+			highlighted: true,
+		},
+		{
+			name:        "Escaped",
+			value:       "<b>Jo",
+			headline:    "<b>" + headlineStart + "Jo" + headlineStop,
+			want:        "&lt;b&gt;<mark>Jo</mark>",
+			highlighted: true,
+		},
+		{
+			name:        "Similar",
+			value:       "Jon&Co",
+			headline:    "Jon&Co",
+			similar:     true,
+			want:        "<mark>Jon&amp;Co</mark>",
+			highlighted: true,
+		},
+		{
+			name:     "No Match",
+			value:    "Smith",
+			headline: "Smith",
+		},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			got, ok := highlight(v.value, v.headline, v.similar)
+			require.Equal(t, v.highlighted, ok)
+			require.Equal(t, v.want, got)
+		})
+	}
+}
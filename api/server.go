@@ -1,33 +1,215 @@
 package api
 
 import (
+	"encoding/base64"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/email"
+	"github.com/rafdekar/user-api/lockout"
+	"github.com/rafdekar/user-api/mail"
+	"github.com/rafdekar/user-api/password"
+	"github.com/rafdekar/user-api/security"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/util"
+	"log"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 )
 
 // Server serves all HTTP requests for banking service
 type Server struct {
-	queries db.Querier
-	router  *gin.Engine
+	config     util.Config
+	store      db.Store
+	hasher     password.Hasher
+	emails     email.Normalizer
+	mailer     mail.Mailer
+	tokenMaker token.Maker
+	router     *gin.Engine
+	// dummyPasswordHash is verified for logins which match no account, so that they take as long as wrong passwords
+	dummyPasswordHash string
+	// passwordResetEmailLimiter limits reset emails sent to a single address and passwordResetIPLimiter
+	// limits both requesting and performing resets from a single IP
+	passwordResetEmailLimiter *rateLimiter
+	passwordResetIPLimiter    *rateLimiter
+	// mfaLimiter limits codes entered for a single user, so that they can not be guessed
+	mfaLimiter *rateLimiter
+	// accountLockout and ipLockout lock logins after too many failures of an account or from an IP,
+	// their state is shared by all instances of the server
+	accountLockout *lockout.Lockout
+	ipLockout      *lockout.Lockout
+	events         security.Emitter
+	// now returns the current time, TOTP codes are checked against it and tests replace it to move the clock
+	now func() time.Time
+	// background tracks work which goes on after the response is sent, tests wait for it to finish
+	background sync.WaitGroup
 }
 
 // NewServer starts a new server
-func NewServer(db db.Querier) *Server {
+func NewServer(config util.Config, store db.Store) (*Server, error) {
+	hasher, err := password.NewHasher(
+		config.PasswordHashAlgorithm,
+		config.BcryptCost,
+		password.Argon2idParams{
+			Memory:      config.Argon2Memory,
+			Iterations:  config.Argon2Iterations,
+			Parallelism: config.Argon2Parallelism,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create password hasher: %w", err)
+	}
+
+	dummyPassword, err := newLinkToken()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate dummy password: %w", err)
+	}
+
+	dummyPasswordHash, err := hasher.Hash(dummyPassword)
+	if err != nil {
+		return nil, fmt.Errorf("could not hash dummy password: %w", err)
+	}
+
+	ed25519Seed, err := base64.StdEncoding.DecodeString(config.TokenEd25519Seed)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode ed25519 seed: %w", err)
+	}
+
+	tokenMaker, err := token.NewMaker(config.TokenAlgorithm, config.TokenSecretKey, ed25519Seed)
+	if err != nil {
+		return nil, fmt.Errorf("could not create token maker: %w", err)
+	}
+
+	mailer, err := mail.NewMailer(
+		config.Mailer,
+		config.MailFrom,
+		mail.SMTPConfig{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+		},
+		config.MailDir,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create mailer: %w", err)
+	}
+
+	for _, link := range []string{config.EmailVerificationURL, config.PasswordResetURL} {
+		if u, err := url.Parse(link); err != nil || !u.IsAbs() {
+			return nil, fmt.Errorf("invalid link url %q", link)
+		}
+	}
+	if config.EmailVerificationTokenDuration <= 0 || config.PasswordResetTokenDuration <= 0 {
+		return nil, fmt.Errorf(
+			"invalid token durations, email verification %s, password reset %s",
+			config.EmailVerificationTokenDuration, config.PasswordResetTokenDuration,
+		)
+	}
+	if config.PasswordResetEmailLimit < 1 || config.PasswordResetIPLimit < 1 || config.PasswordResetLimitWindow <= 0 {
+		return nil, fmt.Errorf(
+			"invalid password reset limits %d per email and %d per IP in %s",
+			config.PasswordResetEmailLimit, config.PasswordResetIPLimit, config.PasswordResetLimitWindow,
+		)
+	}
+
+	if config.MFAIssuer == "" || config.MFATokenDuration <= 0 || config.MFAAttemptLimit < 1 || config.MFAAttemptWindow <= 0 {
+		return nil, fmt.Errorf(
+			"invalid mfa config, issuer %q, token duration %s, %d attempts in %s",
+			config.MFAIssuer, config.MFATokenDuration, config.MFAAttemptLimit, config.MFAAttemptWindow,
+		)
+	}
+
+	lockoutStore, err := lockout.NewStore(config.LockoutStore, store)
+	if err != nil {
+		return nil, fmt.Errorf("could not create lockout store: %w", err)
+	}
+
+	accountLockout, err := lockout.NewLockout(lockoutStore, lockout.Policy{
+		FreeAttempts: config.LockoutAccountAttempts,
+		BaseDelay:    config.LockoutBaseDelay,
+		MaxDelay:     config.LockoutMaxDelay,
+		ResetAfter:   config.LockoutFailureRetention,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create account lockout: %w", err)
+	}
+
+	ipLockout, err := lockout.NewLockout(lockoutStore, lockout.Policy{
+		FreeAttempts: config.LockoutIPAttempts,
+		BaseDelay:    config.LockoutBaseDelay,
+		MaxDelay:     config.LockoutMaxDelay,
+		ResetAfter:   config.LockoutFailureRetention,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create ip lockout: %w", err)
+	}
+
 	server := &Server{
-		queries: db,
+		config:     config,
+		store:      store,
+		hasher:     hasher,
+		emails:     email.NewNormalizer(config.EmailProviderRules),
+		mailer:     mailer,
+		tokenMaker: tokenMaker,
+
+		dummyPasswordHash:         dummyPasswordHash,
+		passwordResetEmailLimiter: newRateLimiter(config.PasswordResetEmailLimit, config.PasswordResetLimitWindow),
+		passwordResetIPLimiter:    newRateLimiter(config.PasswordResetIPLimit, config.PasswordResetLimitWindow),
+		mfaLimiter:                newRateLimiter(config.MFAAttemptLimit, config.MFAAttemptWindow),
+		accountLockout:            accountLockout,
+		ipLockout:                 ipLockout,
+		events:                    security.NewLogEmitter(log.Default()),
+		now:                       time.Now,
+	}
+	if config.NameMinLength < 1 || config.NameMaxLength < config.NameMinLength {
+		return nil, fmt.Errorf("invalid name length limits %d-%d", config.NameMinLength, config.NameMaxLength)
+	}
+
+	if err := registerValidators(config); err != nil {
+		return nil, err
 	}
 	router := gin.Default()
+	// client IPs are taken from X-Forwarded-For only behind trusted proxies, otherwise clients could
+	// spoof them to avoid IP locks and rate limits
+	router.TrustedProxies = config.TrustedProxies
 
 	router.POST("/users", server.createUser)
-	router.GET("/users", server.listUsers)
-	router.PUT("/users", server.updateUser)
-	router.DELETE("/users", server.deleteUser)
+	router.POST("/users/login", server.loginUser)
+	router.POST("/users/login/mfa", server.loginUserMFA)
+	router.POST("/tokens/refresh", server.renewAccessToken)
+	router.GET("/countries", server.listCountries)
+	router.GET("/verify-email", server.verifyEmail)
+	router.POST("/password/forgot", server.forgotPassword)
+	router.POST("/password/reset", server.resetPassword)
+
+	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
+	authRoutes.GET("/users", authorize(listUsersPolicy), server.listUsers)
+	authRoutes.GET("/users/search", authorize(searchUsersPolicy), server.searchUsers)
+	authRoutes.GET("/users/:id", server.getUser)
+	authRoutes.PUT("/users/:id", server.updateUser)
+	authRoutes.PATCH("/users/:id", server.patchUser)
+	authRoutes.DELETE("/users/:id", server.deleteUser)
+	authRoutes.POST("/users/:id/restore", server.restoreUser)
+	authRoutes.POST("/users/:id/verify-email/send", server.sendEmailVerification)
+	authRoutes.GET("/users/:id/mfa", server.getMFA)
+	authRoutes.POST("/users/:id/mfa", server.enrollMFA)
+	authRoutes.POST("/users/:id/mfa/confirm", server.confirmMFA)
+	authRoutes.POST("/users/:id/mfa/recovery-codes", server.regenerateRecoveryCodes)
+	authRoutes.DELETE("/users/:id/mfa", server.disableMFA)
+	authRoutes.GET("/users/:id/lockout", server.getLockout)
+	authRoutes.DELETE("/users/:id/lockout", server.unlockUser)
+	authRoutes.PUT("/users", server.legacyUpdateUser)
+	authRoutes.DELETE("/users", server.legacyDeleteUser)
+	authRoutes.POST("/users/logout", server.logoutUser)
+	authRoutes.POST("/users/logout-all", server.logoutUserEverywhere)
 
 	router.HEAD("/_health", server.health)
 
 	server.router = router
-	return server
+	return server, nil
 }
 
 // Start method starts gin on specified address
@@ -39,8 +221,3 @@ func (s *Server) Start(address string) error {
 func (s *Server) health(ctx *gin.Context) {
 	ctx.String(http.StatusOK, "PONG")
 }
-
-// errorResponse is function for formatting error responses to be returned by gin handler
-func errorResponse(err error) gin.H {
-	return gin.H{"err": err.Error()}
-}
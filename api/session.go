@@ -0,0 +1,130 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	"github.com/rafdekar/user-api/token"
+	"net/http"
+	"time"
+)
+
+var errInvalidSession = apperror.New(apperror.KindUnauthorized, "invalid_session", "session is invalid")
+
+// hashToken returns hex encoded SHA-256 of the token, only the hash of refresh token is stored in the session
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+type renewAccessTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type renewAccessTokenResponse struct {
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+}
+
+// renewAccessToken defines endpoint for exchanging refresh token of an active session for a new access token
+func (s *Server) renewAccessToken(ctx *gin.Context) {
+	request := &renewAccessTokenRequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	refreshPayload, err := s.tokenMaker.VerifyToken(request.RefreshToken, token.TypeRefresh)
+	if err != nil {
+		respondWithError(ctx, tokenError(err, apperror.KindUnauthorized))
+		return
+	}
+
+	session, err := s.store.GetSession(ctx, refreshPayload.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errInvalidSession)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	if session.Revoked ||
+		time.Now().After(session.ExpiresAt) ||
+		session.UserID != refreshPayload.UserID ||
+		subtle.ConstantTimeCompare([]byte(session.RefreshTokenHash), []byte(hashToken(request.RefreshToken))) != 1 {
+		respondWithError(ctx, errInvalidSession)
+		return
+	}
+
+	roles, err := s.userRoles(ctx, session.UserID)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	roles = withoutMFARoles(roles, session.MfaAuthenticated)
+
+	accessToken, accessPayload, err := s.tokenMaker.CreateToken(session.UserID, roles, token.TypeAccess, s.config.AccessTokenDuration)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	response := renewAccessTokenResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+type logoutUserRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// logoutUser defines endpoint for revoking the session of given refresh token
+func (s *Server) logoutUser(ctx *gin.Context) {
+	request := &logoutUserRequest{}
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	refreshPayload, err := s.tokenMaker.VerifyToken(request.RefreshToken, token.TypeRefresh)
+	if err != nil && !errors.Is(err, token.ErrExpiredToken) {
+		respondWithError(ctx, tokenError(err, apperror.KindInvalid))
+		return
+	}
+
+	// expired refresh token can not be renewed anyway, so logging it out is a no-op
+	if err == nil {
+		if refreshPayload.UserID != authorizationPayload(ctx).UserID {
+			respondWithError(ctx, errForbidden)
+			return
+		}
+
+		err = s.store.RevokeSession(ctx, refreshPayload.ID)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+// logoutUserEverywhere defines endpoint for revoking all sessions of the authenticated user
+func (s *Server) logoutUserEverywhere(ctx *gin.Context) {
+	err := s.store.RevokeUserSessions(ctx, authorizationPayload(ctx).UserID)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
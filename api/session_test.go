@@ -0,0 +1,325 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func createTestSession(t *testing.T, tokenMaker token.Maker, userID uuid.UUID, duration time.Duration) (string, db.Session) {
+	refreshToken, payload, err := tokenMaker.CreateToken(userID, []string{util.RoleUser}, token.TypeRefresh, duration)
+	require.NoError(t, err)
+
+	session := db.Session{
+		ID:               payload.ID,
+		UserID:           userID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        payload.ExpiredAt,
+	}
+
+	return refreshToken, session
+}
+
+func TestRenewAccessTokenApi(t *testing.T) {
+	userID := uuid.New()
+
+	testCases := []struct {
+		name          string
+		buildRequest  func(t *testing.T, tokenMaker token.Maker) (string, db.Session)
+		buildStubs    func(store *mockdb.MockStore, session db.Session)
+		checkResponse func(t *testing.T, tokenMaker token.Maker, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildRequest: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := createTestSession(t, tokenMaker, userID, time.Minute)
+				session.MfaAuthenticated = true
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(session, nil)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(userID)).
+					Times(1).
+					Return([]string{util.RoleAdmin}, nil)
+			},
+			checkResponse: func(t *testing.T, tokenMaker token.Maker, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &renewAccessTokenResponse{}
+				err := json.Unmarshal(recorder.Body.Bytes(), response)
+				require.NoError(t, err)
+
+				payload, err := tokenMaker.VerifyToken(response.AccessToken, token.TypeAccess)
+				require.NoError(t, err)
+				require.Equal(t, userID, payload.UserID)
+				require.True(t, payload.HasRole(util.RoleAdmin))
+			},
+		},
+		{
+			name: "Admin Without MFA",
+			buildRequest: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				return createTestSession(t, tokenMaker, userID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(session, nil)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(userID)).
+					Times(1).
+					Return([]string{util.RoleAdmin}, nil)
+			},
+			checkResponse: func(t *testing.T, tokenMaker token.Maker, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &renewAccessTokenResponse{}
+				err := json.Unmarshal(recorder.Body.Bytes(), response)
+				require.NoError(t, err)
+
+				payload, err := tokenMaker.VerifyToken(response.AccessToken, token.TypeAccess)
+				require.NoError(t, err)
+				require.False(t, payload.HasRole(util.RoleAdmin))
+				require.True(t, payload.HasRole(util.RoleUser))
+			},
+		},
+		{
+			name: "Access Token",
+			buildRequest: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				accessToken, _, err := tokenMaker.CreateToken(userID, []string{util.RoleUser}, token.TypeAccess, time.Minute)
+				require.NoError(t, err)
+				return accessToken, db.Session{}
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, tokenMaker token.Maker, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Session Not Found",
+			buildRequest: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				return createTestSession(t, tokenMaker, userID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(db.Session{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, tokenMaker token.Maker, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Revoked Session",
+			buildRequest: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := createTestSession(t, tokenMaker, userID, time.Minute)
+				session.Revoked = true
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(session, nil)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, tokenMaker token.Maker, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Mismatched Token Hash",
+			buildRequest: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := createTestSession(t, tokenMaker, userID, time.Minute)
+				session.RefreshTokenHash = hashToken(util.RandomWord(10))
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(session, nil)
+			},
+			checkResponse: func(t *testing.T, tokenMaker token.Maker, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Internal Server Error",
+			buildRequest: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				return createTestSession(t, tokenMaker, userID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(db.Session{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, tokenMaker token.Maker, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			refreshToken, session := v.buildRequest(t, server.tokenMaker)
+			v.buildStubs(store, session)
+
+			body, err := json.Marshal(renewAccessTokenRequest{RefreshToken: refreshToken})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", "/tokens/refresh", bytes.NewBuffer(body))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, server.tokenMaker, recorder)
+		})
+	}
+}
+
+func TestLogoutUserApi(t *testing.T) {
+	userID := uuid.New()
+
+	testCases := []struct {
+		name          string
+		sessionUserID uuid.UUID
+		buildStubs    func(store *mockdb.MockStore, session db.Session)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:          "OK",
+			sessionUserID: userID,
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().RevokeSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:          "Session Of Other User",
+			sessionUserID: uuid.New(),
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().RevokeSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:          "Internal Server Error",
+			sessionUserID: userID,
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().RevokeSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			refreshToken, session := createTestSession(t, server.tokenMaker, v.sessionUserID, time.Minute)
+			v.buildStubs(store, session)
+
+			body, err := json.Marshal(logoutUserRequest{RefreshToken: refreshToken})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", "/users/logout", bytes.NewBuffer(body))
+			require.NoError(t, err)
+
+			addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, userID, []string{util.RoleUser}, time.Minute)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLogoutUserEverywhereApi(t *testing.T) {
+	userID := uuid.New()
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(userID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Internal Server Error",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(userID)).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", "/users/logout-all", nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, userID, []string{util.RoleUser}, time.Minute)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
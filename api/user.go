@@ -2,134 +2,573 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/apperror"
+	"github.com/rafdekar/user-api/country"
 	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/password"
+	"github.com/rafdekar/user-api/token"
 	"net/http"
+	"time"
+)
+
+var (
+	errInvalidCredentials = apperror.New(apperror.KindUnauthorized, "invalid_credentials", "invalid login or password")
+	errUserNotFound       = apperror.New(apperror.KindNotFound, apperror.CodeNotFound, "user not found")
+	// errDeletedUserNotFound is returned when restored user does not exist, is not deleted or was already purged
+	errDeletedUserNotFound = apperror.New(apperror.KindNotFound, apperror.CodeNotFound, "deleted user not found")
 )
 
 type createUserRequest struct {
-	FirstName string `json:"first_name" binding:"alpha"`
-	LastName  string `json:"last_name" binding:"alpha"`
+	FirstName string `json:"first_name" binding:"personal_name,name_length"`
+	LastName  string `json:"last_name" binding:"personal_name,name_length"`
 	Nickname  string `json:"nickname"`
 	Password  string `json:"password"`
 	Email     string `json:"email" binding:"email"`
-	Country   string `json:"country" binding:"len=2,alpha"`
+	Country   string `json:"country" binding:"iso3166_alpha2"`
 }
 
 // createUser method defines endpoint for createing a user
 func (s *Server) createUser(ctx *gin.Context) {
 	request := &createUserRequest{}
 	if err := ctx.ShouldBindJSON(request); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(request.Password)
+	if err != nil {
+		respondWithError(ctx, err)
 		return
 	}
 
 	params := db.CreateUserParams{
-		FirstName: request.FirstName,
-		LastName:  request.LastName,
+		FirstName: normalizeName(request.FirstName),
+		LastName:  normalizeName(request.LastName),
 		Nickname:  request.Nickname,
-		Password:  request.Password,
-		Email:     request.Email,
-		Country:   request.Country,
+		Password:  hashedPassword,
+		Email:     s.emails.Normalize(request.Email),
+		Country:   country.Normalize(request.Country),
+	}
+
+	user, err := s.store.CreateUser(ctx, params)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	// the user is created even when the email can not be sent, verification can be requested again later
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		_ = ctx.Error(err)
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type userIDRequest struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+// bindUserID binds user ID from the URI, it responds with 400 and returns false when the ID is malformed
+func bindUserID(ctx *gin.Context) (uuid.UUID, bool) {
+	request := &userIDRequest{}
+	if err := ctx.ShouldBindUri(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(request.ID)
+	if err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// getUser method defines endpoint for getting a single user, it supports conditional requests
+func (s *Server) getUser(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !getUserPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
 	}
 
-	user, err := s.queries.CreateUser(ctx, params)
+	user, err := s.store.GetUser(ctx, id)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondWithError(ctx, err)
+		return
+	}
+
+	setUserCacheHeaders(ctx, user)
+	if isNotModified(ctx, user) {
+		ctx.Status(http.StatusNotModified)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, user)
+	ctx.JSON(http.StatusOK, newUserResponse(user))
 }
 
 type updateUserRequest struct {
-	ID        uuid.UUID `json:"id" binding:"required"`
-	FirstName string    `json:"first_name" binding:"alpha"`
-	LastName  string    `json:"last_name" binding:"alpha"`
-	Nickname  string    `json:"nickname"`
-	Password  string    `json:"password"`
-	Email     string    `json:"email" binding:"email"`
-	Country   string    `json:"country" binding:"len=2,alpha"`
+	FirstName string `json:"first_name" binding:"personal_name,name_length"`
+	LastName  string `json:"last_name" binding:"personal_name,name_length"`
+	Nickname  string `json:"nickname"`
+	Password  string `json:"password"`
+	Email     string `json:"email" binding:"email"`
+	Country   string `json:"country" binding:"iso3166_alpha2"`
 }
 
 // updateUser method defines endpoint for updating selected user data
 func (s *Server) updateUser(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
 	request := &updateUserRequest{}
 	if err := ctx.ShouldBindJSON(request); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	s.updateUserByID(ctx, id, request, true)
+}
+
+// updateUserByID replaces data of the user with given ID, it is shared by updateUser and legacyUpdateUser,
+// ifMatchRequired is unset only for the legacy route whose clients do not send If-Match
+func (s *Server) updateUserByID(ctx *gin.Context, id uuid.UUID, request *updateUserRequest, ifMatchRequired bool) {
+	if !updateUserPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	current, ok := s.matchedUser(ctx, id, ifMatchRequired)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(request.Password)
+	if err != nil {
+		respondWithError(ctx, err)
 		return
 	}
 
 	params := db.UpdateUserParams{
-		ID:        request.ID,
-		FirstName: request.FirstName,
-		LastName:  request.LastName,
+		ID:        id,
+		FirstName: normalizeName(request.FirstName),
+		LastName:  normalizeName(request.LastName),
 		Nickname:  request.Nickname,
-		Password:  request.Password,
-		Email:     request.Email,
-		Country:   request.Country,
+		Password:  hashedPassword,
+		Email:     s.emails.Normalize(request.Email),
+		Country:   country.Normalize(request.Country),
+		Version:   current.Version,
 	}
 
-	user, err := s.queries.UpdateUser(ctx, params)
+	user, err := s.store.UpdateUser(ctx, params)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errPreconditionFailed)
+			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondWithError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, user)
+	setUserCacheHeaders(ctx, user)
+	ctx.JSON(http.StatusOK, newUserResponse(user))
 }
 
+// matchedUser reads the user which is going to be changed and evaluates If-Match header of the request against it,
+// it responds with an error and returns false when the change can not proceed. Requests without the header are
+// rejected only when ifMatchRequired is set, otherwise the last write wins.
+func (s *Server) matchedUser(ctx *gin.Context, id uuid.UUID, ifMatchRequired bool) (db.User, bool) {
+	ifMatch := ctx.GetHeader("If-Match")
+	if ifMatch == "" && ifMatchRequired {
+		respondWithError(ctx, errPreconditionRequired)
+		return db.User{}, false
+	}
+
+	user, err := s.store.GetUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errUserNotFound)
+			return db.User{}, false
+		}
+		respondWithError(ctx, err)
+		return db.User{}, false
+	}
+
+	if ifMatch != "" && !checkIfMatch(ctx, ifMatch, user) {
+		return db.User{}, false
+	}
+
+	return user, true
+}
+
+// listUsersRequest limits page_number so that offset of the page always fits in int32
 type listUsersRequest struct {
-	PageSize   int32 `json:"page_size" binding:"required,min=1"`
-	PageNumber int32 `json:"page_number" binding:"required,min=1"`
+	userFilterRequest
+	PageSize       int32  `form:"page_size" json:"page_size" binding:"required,min=1,max=100"`
+	PageNumber     int32  `form:"page_number" json:"page_number" binding:"required,min=1,max=1000000"`
+	IncludeDeleted bool   `form:"include_deleted" json:"include_deleted"`
+	Sort           string `form:"sort" json:"-"`
+	Count          string `form:"count" json:"-" binding:"omitempty,oneof=exact estimated"`
 }
 
-// listUsers method defines endpoint for listing users from page X of size Y
+// listUsers method defines endpoint for listing users from page X of size Y passed in the query string,
+// requests with limit or after parameters are paginated with cursors instead
 func (s *Server) listUsers(ctx *gin.Context) {
+	_, hasLimit := ctx.GetQuery("limit")
+	_, hasAfter := ctx.GetQuery("after")
+	if hasLimit || hasAfter {
+		s.listUsersByCursor(ctx)
+		return
+	}
+
 	request := &listUsersRequest{}
-	if err := ctx.ShouldBindJSON(request); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+	legacy, err := bindListUsersRequest(ctx, request)
+	if err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	sort, err := parseUserSort(request.Sort)
+	if err != nil {
+		respondWithError(ctx, err)
 		return
 	}
 
-	params := db.ListUsersParams{
-		Offset: (request.PageNumber - 1) * request.PageSize,
-		Limit:  request.PageSize,
+	if request.IncludeDeleted && !listDeletedUsersPolicy.allows(authorizationPayload(ctx), uuid.Nil) {
+		respondWithError(ctx, errForbidden)
+		return
 	}
 
-	users, err := s.queries.ListUsers(ctx, params)
+	params := request.params()
+	params.IncludeDeleted = request.IncludeDeleted
+	params.Sort = sort
+	params.Limit = request.PageSize
+	params.Offset = (request.PageNumber - 1) * request.PageSize
+
+	users, err := s.store.ListUsersFiltered(ctx, params)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondWithError(ctx, err)
+		return
+	}
+
+	// deprecated requests keep getting the bare array they were written for
+	if legacy {
+		ctx.JSON(http.StatusOK, newUserListResponse(users))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, users)
+	page := offsetPage{
+		Items:    newUserListResponse(users),
+		Page:     request.PageNumber,
+		PageSize: request.PageSize,
+	}
+	page.Total, page.TotalEstimated, err = s.countUsers(ctx, request, params)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.Header("Link", page.links(ctx.Request.URL))
+	ctx.JSON(http.StatusOK, page)
+}
+
+// countUsers returns total number of users matching the request, statistics of the table are used only
+// when estimation is requested and no filters are applied, since they describe the whole table. The estimate
+// is approximate, but it excludes deleted users unless they are listed, just like the exact count.
+func (s *Server) countUsers(ctx *gin.Context, request *listUsersRequest, params db.ListUsersFilteredParams) (int64, bool, error) {
+	if request.Count == countEstimated && request.userFilterRequest == (userFilterRequest{}) {
+		estimate, err := s.store.EstimateUsers(ctx, params.IncludeDeleted)
+		if err != nil {
+			return 0, false, err
+		}
+		if estimate > 0 {
+			return estimate, true, nil
+		}
+	}
+
+	total, err := s.store.CountUsersFiltered(ctx, params)
+	return total, false, err
+}
+
+type listUsersByCursorRequest struct {
+	userFilterRequest
+	After          string `form:"after"`
+	Limit          int32  `form:"limit" binding:"omitempty,min=1,max=100"`
+	IncludeDeleted bool   `form:"include_deleted"`
 }
 
-type deleteUserRequest struct {
-	ID uuid.UUID `json:"ID" binding:"required"`
+// listUsersByCursor lists users in (created_at, id) order starting after the cursor, unlike page numbers
+// cursors keep pages stable when users are created in the meantime
+func (s *Server) listUsersByCursor(ctx *gin.Context) {
+	if _, ok := ctx.GetQuery("sort"); ok {
+		respondWithError(ctx, errSortedCursor)
+		return
+	}
+
+	request := &listUsersByCursorRequest{}
+	if err := ctx.ShouldBindQuery(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+	if request.Limit == 0 {
+		request.Limit = defaultCursorLimit
+	}
+
+	cursor, err := decodeUserCursor(request.After)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	if request.IncludeDeleted && !listDeletedUsersPolicy.allows(authorizationPayload(ctx), uuid.Nil) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	params := request.params()
+	params.IncludeDeleted = request.IncludeDeleted
+	params.AfterCreatedAt = cursor.CreatedAt
+	params.AfterID = cursor.ID
+	params.Limit = request.Limit + 1
+
+	users, err := s.store.ListUsersFiltered(ctx, params)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	page := newCursorPage(users, request.Limit)
+	ctx.Header("Link", page.links(ctx.Request.URL, request.Limit))
+	ctx.JSON(http.StatusOK, page)
 }
 
-// deleteUser defines endpoint for completely deleting user data
+// deleteUser defines endpoint for deleting a user, deleted users can be restored until they are purged
 func (s *Server) deleteUser(ctx *gin.Context) {
-	request := &deleteUserRequest{}
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	s.deleteUserByID(ctx, id, true)
+}
+
+// deleteUserByID deletes the user with given ID, it is shared by deleteUser and legacyDeleteUser,
+// ifMatchRequired is unset only for the legacy route whose clients do not send If-Match
+func (s *Server) deleteUserByID(ctx *gin.Context, id uuid.UUID, ifMatchRequired bool) {
+	if !deleteUserPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	current, ok := s.matchedUser(ctx, id, ifMatchRequired)
+	if !ok {
+		return
+	}
+
+	rows, err := s.store.DeleteUser(ctx, db.DeleteUserParams{
+		ID:      id,
+		Version: current.Version,
+	})
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	// the user was changed or deleted after matchedUser had read it
+	if rows == 0 {
+		respondWithError(ctx, errPreconditionFailed)
+		return
+	}
+
+	err = s.store.RevokeUserSessions(ctx, id)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+// restoreUser defines endpoint for restoring a deleted user which has not been purged yet
+func (s *Server) restoreUser(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !restoreUserPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	user, err := s.store.RestoreUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errDeletedUserNotFound)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type loginUserRequest struct {
+	Login    string `json:"login" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type loginUserResponse struct {
+	SessionID             uuid.UUID    `json:"session_id"`
+	AccessToken           string       `json:"access_token"`
+	AccessTokenExpiresAt  time.Time    `json:"access_token_expires_at"`
+	RefreshToken          string       `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time    `json:"refresh_token_expires_at"`
+	User                  userResponse `json:"user"`
+}
+
+// loginUser defines endpoint for exchanging nickname or email and password for access and refresh tokens
+func (s *Server) loginUser(ctx *gin.Context) {
+	request := &loginUserRequest{}
 	if err := ctx.ShouldBindJSON(request); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondWithError(ctx, apperror.Invalid(err))
 		return
 	}
 
-	err := s.queries.DeleteUser(ctx, request.ID)
+	if !s.checkLockout(ctx, s.ipLockout, ipLockoutKey(ctx.ClientIP()), nil) {
+		return
+	}
+
+	user, err := s.store.GetUserByLogin(ctx, db.GetUserByLoginParams{
+		Nickname: request.Login,
+		Email:    s.emails.Normalize(request.Login),
+	})
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
+		if errors.Is(err, sql.ErrNoRows) {
+			loginKey := loginLockoutKey(s.emails.Normalize(request.Login))
+			if s.checkLockout(ctx, s.accountLockout, loginKey, nil) {
+				// the result does not matter, the password is verified only so that the response is not faster
+				// than for existing accounts
+				_ = s.hasher.Verify(s.dummyPasswordHash, request.Password)
+				s.failLogin(ctx, loginKey, nil)
+			}
+			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondWithError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{})
+	accountKey := accountLockoutKey(user.ID)
+	if !s.checkLockout(ctx, s.accountLockout, accountKey, &user.ID) {
+		return
+	}
+
+	err = s.hasher.Verify(user.Password, request.Password)
+	if err != nil {
+		if errors.Is(err, password.ErrMismatchedPassword) {
+			s.failLogin(ctx, accountKey, &user.ID)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	err = s.accountLockout.Reset(ctx, accountKey)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	if s.config.EmailVerificationRequired && !user.EmailVerifiedAt.Valid {
+		respondWithError(ctx, errEmailNotVerified)
+		return
+	}
+
+	if s.hasher.NeedsRehash(user.Password) {
+		hashedPassword, err := s.hasher.Hash(request.Password)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+
+		err = s.store.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+			ID:       user.ID,
+			Password: hashedPassword,
+		})
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+	}
+
+	mfaEnabled, err := s.mfaEnabled(ctx, user.ID)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	if mfaEnabled {
+		s.requireMFA(ctx, user)
+		return
+	}
+
+	s.startSession(ctx, user, false)
+}
+
+// startSession creates a new session of the user who has just logged in and responds with its tokens,
+// roles which require the second factor are granted only when mfaAuthenticated is set
+func (s *Server) startSession(ctx *gin.Context, user db.User, mfaAuthenticated bool) {
+	roles, err := s.userRoles(ctx, user.ID)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	roles = withoutMFARoles(roles, mfaAuthenticated)
+
+	accessToken, accessPayload, err := s.tokenMaker.CreateToken(user.ID, roles, token.TypeAccess, s.config.AccessTokenDuration)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	refreshToken, refreshPayload, err := s.tokenMaker.CreateToken(user.ID, roles, token.TypeRefresh, s.config.RefreshTokenDuration)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	session, err := s.store.CreateSession(ctx, db.CreateSessionParams{
+		ID:               refreshPayload.ID,
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        ctx.Request.UserAgent(),
+		ClientIp:         ctx.ClientIP(),
+		ExpiresAt:        refreshPayload.ExpiredAt.UTC(),
+		MfaAuthenticated: mfaAuthenticated,
+	})
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	response := loginUserResponse{
+		SessionID:             session.ID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiredAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
+		User:                  newUserResponse(user),
+	}
+
+	ctx.JSON(http.StatusOK, response)
 }
@@ -4,18 +4,95 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rafdekar/user-api/apperror"
 	mockdb "github.com/rafdekar/user-api/db/mock"
 	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/password"
+	"github.com/rafdekar/user-api/token"
 	"github.com/rafdekar/user-api/util"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
+type eqCreateUserParamsMatcher struct {
+	arg      db.CreateUserParams
+	password string
+}
+
+// Matches checks if params are equal apart from the password, which has to be a valid hash of the expected one
+func (e eqCreateUserParamsMatcher) Matches(x interface{}) bool {
+	arg, ok := x.(db.CreateUserParams)
+	if !ok {
+		return false
+	}
+
+	if !matchesPasswordHash(arg.Password, e.password) {
+		return false
+	}
+
+	e.arg.Password = arg.Password
+	return gomock.Eq(e.arg).Matches(arg)
+}
+
+func (e eqCreateUserParamsMatcher) String() string {
+	return fmt.Sprintf("matches arg %v and password %v", e.arg, e.password)
+}
+
+func eqCreateUserParams(arg db.CreateUserParams, password string) gomock.Matcher {
+	return eqCreateUserParamsMatcher{arg, password}
+}
+
+type eqUpdateUserParamsMatcher struct {
+	arg      db.UpdateUserParams
+	password string
+}
+
+// Matches checks if params are equal apart from the password, which has to be a valid hash of the expected one
+func (e eqUpdateUserParamsMatcher) Matches(x interface{}) bool {
+	arg, ok := x.(db.UpdateUserParams)
+	if !ok {
+		return false
+	}
+
+	if !matchesPasswordHash(arg.Password, e.password) {
+		return false
+	}
+
+	e.arg.Password = arg.Password
+	return gomock.Eq(e.arg).Matches(arg)
+}
+
+func (e eqUpdateUserParamsMatcher) String() string {
+	return fmt.Sprintf("matches arg %v and password %v", e.arg, e.password)
+}
+
+func eqUpdateUserParams(arg db.UpdateUserParams, password string) gomock.Matcher {
+	return eqUpdateUserParamsMatcher{arg, password}
+}
+
+func matchesPasswordHash(hash string, plain string) bool {
+	if hash == plain {
+		return false
+	}
+
+	hasher, err := password.NewBcryptHasher(bcrypt.MinCost)
+	if err != nil {
+		return false
+	}
+
+	return hasher.Verify(hash, plain) == nil
+}
+
 func randomUser() db.User {
 	return db.User{
 		ID:        uuid.New(),
@@ -25,6 +102,7 @@ func randomUser() db.User {
 		Password:  util.RandomWord(10),
 		Nickname:  util.RandomWord(10),
 		Country:   util.RandomCountry(),
+		Version:   util.RandomInt(1, 1000),
 	}
 }
 
@@ -33,19 +111,43 @@ func requireBodyMatchUser(t *testing.T, body *bytes.Buffer, user *db.User) {
 	require.NoError(t, err)
 	require.NotEmpty(t, buffer)
 
-	userToCompare := &db.User{}
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(buffer, &fields)
+	require.NoError(t, err)
+	require.NotContains(t, fields, "password")
+
+	userToCompare := &userResponse{}
 	err = json.Unmarshal(buffer, userToCompare)
 	require.NoError(t, err)
 	require.NotEmpty(t, userToCompare)
 
+	require.Equal(t, user.ID, userToCompare.ID)
 	require.Equal(t, user.FirstName, userToCompare.FirstName)
 	require.Equal(t, user.LastName, userToCompare.LastName)
 	require.Equal(t, user.Email, userToCompare.Email)
 	require.Equal(t, user.Nickname, userToCompare.Nickname)
-	require.Equal(t, user.Password, userToCompare.Password)
 	require.Equal(t, user.Country, userToCompare.Country)
 }
 
+func requireBodyMatchUsers(t *testing.T, body *bytes.Buffer, users []db.User) {
+	buffer, err := ioutil.ReadAll(body)
+	require.NoError(t, err)
+	require.NotEmpty(t, buffer)
+
+	var fields []map[string]interface{}
+	err = json.Unmarshal(buffer, &fields)
+	require.NoError(t, err)
+	require.Len(t, fields, len(users))
+	for _, v := range fields {
+		require.NotContains(t, v, "password")
+	}
+
+	var usersToCompare []userResponse
+	err = json.Unmarshal(buffer, &usersToCompare)
+	require.NoError(t, err)
+	require.Equal(t, newUserListResponse(users), usersToCompare)
+}
+
 func TestCreateUserApi(t *testing.T) {
 	user := randomUser()
 	dbParams := db.CreateUserParams{
@@ -60,15 +162,21 @@ func TestCreateUserApi(t *testing.T) {
 	testCases := []struct {
 		name          string
 		sendEmptyBody bool
-		buildStubs    func(querier *mockdb.MockQuerier)
+		invalidEmail  bool
+		email         string
+		country       string
+		firstName     string
+		buildStubs    func(store *mockdb.MockStore)
 		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
 			name: "OK",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().CreateUser(gomock.Any(), gomock.Eq(dbParams)).
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), eqCreateUserParams(dbParams, user.Password)).
 					Times(1).
 					Return(user, nil)
+				store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -78,125 +186,178 @@ func TestCreateUserApi(t *testing.T) {
 		{
 			name:          "Bad Request",
 			sendEmptyBody: true,
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeMalformedRequest)
 			},
 		},
 		{
-			name: "Internal Server Error",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().CreateUser(gomock.Any(), gomock.Eq(dbParams)).
+			name:         "Invalid Email",
+			invalidEmail: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, "email", problem.Errors[0].Field)
+				require.Equal(t, "email", problem.Errors[0].Code)
+			},
+		},
+		{
+			name:  "Upper Case Email",
+			email: strings.ToUpper(user.Email),
+			buildStubs: func(store *mockdb.MockStore) {
+				params := dbParams
+				at := strings.LastIndex(user.Email, "@")
+				params.Email = strings.ToUpper(user.Email[:at]) + user.Email[at:]
+				store.EXPECT().CreateUser(gomock.Any(), eqCreateUserParams(params, user.Password)).
 					Times(1).
-					Return(db.User{}, sql.ErrConnDone)
+					Return(user, nil)
+				store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				require.Equal(t, http.StatusOK, recorder.Code)
 			},
 		},
-	}
-	for _, v := range testCases {
-		t.Run(v.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			querier := mockdb.NewMockQuerier(ctrl)
-			server := NewServer(querier)
-
-			v.buildStubs(querier)
-
-			var body []byte
-			if !v.sendEmptyBody {
-				var err error
-				body, err = json.Marshal(createUserRequest{
-					FirstName: user.FirstName,
-					LastName:  user.LastName,
-					Email:     user.Email,
-					Password:  user.Password,
-					Nickname:  user.Nickname,
-					Country:   user.Country,
-				})
-				require.NoError(t, err)
-				require.NotEmpty(t, body)
-			}
-
-			recorder := httptest.NewRecorder()
-
-			req, err := http.NewRequest("POST", "/users", bytes.NewBuffer(body))
-			require.NoError(t, err)
-			require.NotEmpty(t, req)
-
-			server.router.ServeHTTP(recorder, req)
-
-			v.checkResponse(t, recorder)
-		})
-	}
-}
-
-func TestUpdateUserApi(t *testing.T) {
-	user := randomUser()
-	dbParams := db.UpdateUserParams{
-		ID:        user.ID,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Email:     user.Email,
-		Password:  user.Password,
-		Nickname:  user.Nickname,
-		Country:   user.Country,
-	}
-
-	testCases := []struct {
-		name          string
-		sendEmptyBody bool
-		buildStubs    func(querier *mockdb.MockQuerier)
-		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
-	}{
 		{
-			name: "OK",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().UpdateUser(gomock.Any(), gomock.Eq(dbParams)).
+			name:    "Lower Case Country",
+			country: strings.ToLower(user.Country),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), eqCreateUserParams(dbParams, user.Password)).
 					Times(1).
 					Return(user, nil)
+				store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
-				requireBodyMatchUser(t, recorder.Body, &user)
 			},
 		},
 		{
-			name:          "Bad Request",
-			sendEmptyBody: true,
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+			name:      "International Name",
+			firstName: "Jose\u0301-Łukasz O'Brien",
+			buildStubs: func(store *mockdb.MockStore) {
+				params := dbParams
+				params.FirstName = "Jos\u00e9-Łukasz O'Brien"
+				store.EXPECT().CreateUser(gomock.Any(), eqCreateUserParams(params, user.Password)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:      "Invalid Name",
+			firstName: "R2-D2",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, "first_name", problem.Errors[0].Field)
+				require.Equal(t, tagPersonalName, problem.Errors[0].Code)
 			},
 		},
 		{
-			name: "Not Found",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().UpdateUser(gomock.Any(), gomock.Eq(dbParams)).
+			name:      "Name Too Long",
+			firstName: strings.Repeat("e\u0301", 51),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, tagNameLength, problem.Errors[0].Code)
+			},
+		},
+		{
+			name:    "Unknown Country",
+			country: "ZZ",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, "country", problem.Errors[0].Field)
+				require.Equal(t, tagISO3166Alpha2, problem.Errors[0].Code)
+			},
+		},
+		{
+			name:    "Reserved Country Code",
+			country: "UK",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+			},
+		},
+		{
+			name: "Duplicate Nickname",
+			buildStubs: func(store *mockdb.MockStore) {
+				err := &pq.Error{
+					Code:       "23505",
+					Message:    `duplicate key value violates unique constraint "users_nickname_key"`,
+					Detail:     fmt.Sprintf("Key (nickname)=(%s) already exists.", user.Nickname),
+					Constraint: "users_nickname_key",
+				}
+				store.EXPECT().CreateUser(gomock.Any(), eqCreateUserParams(dbParams, user.Password)).
 					Times(1).
-					Return(db.User{}, sql.ErrNoRows)
+					Return(db.User{}, err)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusNotFound, recorder.Code)
+				problem := requireProblem(t, recorder, http.StatusConflict, apperror.CodeUniqueViolation)
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, "nickname", problem.Errors[0].Field)
+				require.NotContains(t, recorder.Body.String(), "users_nickname_key")
+			},
+		},
+		{
+			name: "Duplicate Email",
+			buildStubs: func(store *mockdb.MockStore) {
+				err := &pq.Error{
+					Code:       "23505",
+					Message:    `duplicate key value violates unique constraint "users_email_lower_key"`,
+					Detail:     fmt.Sprintf("Key (lower(email::text))=(%s) already exists.", user.Email),
+					Constraint: "users_email_lower_key",
+				}
+				store.EXPECT().CreateUser(gomock.Any(), eqCreateUserParams(dbParams, user.Password)).
+					Times(1).
+					Return(db.User{}, err)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusConflict, apperror.CodeUniqueViolation)
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, "email", problem.Errors[0].Field)
+				require.NotContains(t, recorder.Body.String(), "users_email_lower_key")
 			},
 		},
 		{
 			name: "Internal Server Error",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().UpdateUser(gomock.Any(), gomock.Eq(dbParams)).
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), eqCreateUserParams(dbParams, user.Password)).
 					Times(1).
 					Return(db.User{}, sql.ErrConnDone)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				requireProblem(t, recorder, http.StatusInternalServerError, apperror.CodeInternal)
+				require.NotContains(t, recorder.Body.String(), sql.ErrConnDone.Error())
 			},
 		},
 	}
@@ -205,30 +366,42 @@ func TestUpdateUserApi(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			querier := mockdb.NewMockQuerier(ctrl)
-			server := NewServer(querier)
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
 
-			v.buildStubs(querier)
+			v.buildStubs(store)
 
 			var body []byte
 			if !v.sendEmptyBody {
 				var err error
-				body, err = json.Marshal(updateUserRequest{
-					ID:        user.ID,
+				request := createUserRequest{
 					FirstName: user.FirstName,
 					LastName:  user.LastName,
 					Email:     user.Email,
 					Password:  user.Password,
 					Nickname:  user.Nickname,
 					Country:   user.Country,
-				})
+				}
+				if v.invalidEmail {
+					request.Email = util.RandomWord(10)
+				}
+				if v.email != "" {
+					request.Email = v.email
+				}
+				if v.country != "" {
+					request.Country = v.country
+				}
+				if v.firstName != "" {
+					request.FirstName = v.firstName
+				}
+				body, err = json.Marshal(request)
 				require.NoError(t, err)
 				require.NotEmpty(t, body)
 			}
 
 			recorder := httptest.NewRecorder()
 
-			req, err := http.NewRequest("PUT", "/users", bytes.NewBuffer(body))
+			req, err := http.NewRequest("POST", "/users", bytes.NewBuffer(body))
 			require.NoError(t, err)
 			require.NotEmpty(t, req)
 
@@ -239,42 +412,92 @@ func TestUpdateUserApi(t *testing.T) {
 	}
 }
 
-func TestListUsersApi(t *testing.T) {
-	n := 2
-	users := make([]db.User, n)
-
-	for i := 0; i < n; i++ {
-		users[i] = randomUser()
-	}
-
-	dbParams := db.ListUsersParams{
-		Offset: 2,
-		Limit:  2,
-	}
+func TestGetUserApi(t *testing.T) {
+	user := randomUser()
+	user.ModifiedAt = time.Now().UTC().Truncate(time.Second)
 
 	testCases := []struct {
 		name          string
-		sendEmptyBody bool
-		buildStubs    func(querier *mockdb.MockQuerier)
+		userID        string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
 		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
-			name: "OK",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().ListUsers(gomock.Any(), gomock.Eq(dbParams)).
+			name:   "OK",
+			userID: user.ID.String(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
 					Times(1).
-					Return(users, nil)
+					Return(user, nil)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
-
+				require.Equal(t, userETag(user), recorder.Header().Get("ETag"))
+				require.Equal(t, user.ModifiedAt.Format(http.TimeFormat), recorder.Header().Get("Last-Modified"))
+				requireBodyMatchUser(t, recorder.Body, &user)
 			},
 		},
 		{
-			name:          "Bad Request",
-			sendEmptyBody: true,
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().ListUsers(gomock.Any(), gomock.Any()).
+			name:   "Not Modified",
+			userID: user.ID.String(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+				request.Header.Set("If-None-Match", `"other", `+userETag(user))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotModified, recorder.Code)
+				require.Empty(t, recorder.Body.Bytes())
+			},
+		},
+		{
+			name:   "Stale ETag",
+			userID: user.ID.String(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+				request.Header.Set("If-None-Match", `"other"`)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Not Modified Since",
+			userID: user.ID.String(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+				request.Header.Set("If-Modified-Since", user.ModifiedAt.Format(http.TimeFormat))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotModified, recorder.Code)
+			},
+		},
+		{
+			name:   "Bad Request",
+			userID: "not-a-uuid",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -282,11 +505,59 @@ func TestListUsersApi(t *testing.T) {
 			},
 		},
 		{
-			name: "Internal Server Error",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().ListUsers(gomock.Any(), gomock.Eq(dbParams)).
+			name:   "Forbidden",
+			userID: user.ID.String(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "Admin",
+			userID: user.ID.String(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
 					Times(1).
-					Return([]db.User{}, sql.ErrConnDone)
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Not Found",
+			userID: user.ID.String(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "Internal Server Error",
+			userID: user.ID.String(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -298,28 +569,18 @@ func TestListUsersApi(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			querier := mockdb.NewMockQuerier(ctrl)
-			server := NewServer(querier)
-
-			v.buildStubs(querier)
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
 
-			var body []byte
-			if !v.sendEmptyBody {
-				var err error
-				body, err = json.Marshal(listUsersRequest{
-					PageSize:   2,
-					PageNumber: 2,
-				})
-				require.NoError(t, err)
-				require.NotEmpty(t, body)
-			}
+			v.buildStubs(store)
 
 			recorder := httptest.NewRecorder()
 
-			req, err := http.NewRequest("GET", "/users", bytes.NewBuffer(body))
+			req, err := http.NewRequest("GET", "/users/"+v.userID, nil)
 			require.NoError(t, err)
 			require.NotEmpty(t, req)
 
+			v.setupAuth(t, req, server.tokenMaker)
 			server.router.ServeHTTP(recorder, req)
 
 			v.checkResponse(t, recorder)
@@ -327,31 +588,59 @@ func TestListUsersApi(t *testing.T) {
 	}
 }
 
-func TestDeleteUserApi(t *testing.T) {
+func TestUpdateUserApi(t *testing.T) {
 	user := randomUser()
+	dbParams := db.UpdateUserParams{
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Password:  user.Password,
+		Nickname:  user.Nickname,
+		Country:   user.Country,
+		Version:   user.Version,
+	}
+
+	updatedUser := user
+	updatedUser.Version++
 
 	testCases := []struct {
 		name          string
 		sendEmptyBody bool
-		buildStubs    func(querier *mockdb.MockQuerier)
+		ifMatch       string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
 		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
-			name: "OK",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(user.ID)).
+			name:    "OK",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
 					Times(1).
-					Return(nil)
+					Return(user, nil)
+				store.EXPECT().UpdateUser(gomock.Any(), eqUpdateUserParams(dbParams, user.Password)).
+					Times(1).
+					Return(updatedUser, nil)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, userETag(updatedUser), recorder.Header().Get("ETag"))
+				requireBodyMatchUser(t, recorder.Body, &user)
 			},
 		},
 		{
-			name:          "Bad Request",
+			name:    "Bad Request",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
 			sendEmptyBody: true,
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -359,22 +648,174 @@ func TestDeleteUserApi(t *testing.T) {
 			},
 		},
 		{
-			name: "Not Found",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(user.ID)).
-					Times(1).
-					Return(sql.ErrNoRows)
+			name: "Precondition Required",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
 			},
-			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionRequired, "precondition_required")
+			},
+		},
+		{
+			name:    "Precondition Failed",
+			ifMatch: `"stale"`,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionFailed, "precondition_failed")
+				require.Equal(t, userETag(user), recorder.Header().Get("ETag"))
+			},
+		},
+		{
+			name:    "Weak ETag",
+			ifMatch: "W/" + userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+			},
+		},
+		{
+			name:    "Concurrent Update",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().UpdateUser(gomock.Any(), eqUpdateUserParams(dbParams, user.Password)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionFailed, "precondition_failed")
+			},
+		},
+		{
+			name:    "Duplicate Email",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				err := &pq.Error{
+					Code:       "23505",
+					Message:    `duplicate key value violates unique constraint "users_email_lower_key"`,
+					Detail:     fmt.Sprintf("Key (lower(email::text))=(%s) already exists.", updatedUser.Email),
+					Constraint: "users_email_lower_key",
+				}
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, err)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusConflict, apperror.CodeUniqueViolation)
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, "email", problem.Errors[0].Field)
+			},
+		},
+		{
+			name:    "Not Found",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+				store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNotFound, recorder.Code)
 			},
 		},
 		{
-			name: "Internal Server Error",
-			buildStubs: func(querier *mockdb.MockQuerier) {
-				querier.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(user.ID)).
+			name:    "Unauthorized",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:    "Forbidden",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:    "Admin",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().UpdateUser(gomock.Any(), eqUpdateUserParams(dbParams, user.Password)).
+					Times(1).
+					Return(updatedUser, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "Internal Server Error",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
 					Times(1).
-					Return(sql.ErrConnDone)
+					Return(user, nil)
+				store.EXPECT().UpdateUser(gomock.Any(), eqUpdateUserParams(dbParams, user.Password)).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -386,16 +827,21 @@ func TestDeleteUserApi(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			querier := mockdb.NewMockQuerier(ctrl)
-			server := NewServer(querier)
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
 
-			v.buildStubs(querier)
+			v.buildStubs(store)
 
 			var body []byte
 			if !v.sendEmptyBody {
 				var err error
-				body, err = json.Marshal(deleteUserRequest{
-					ID: user.ID,
+				body, err = json.Marshal(updateUserRequest{
+					FirstName: user.FirstName,
+					LastName:  user.LastName,
+					Email:     user.Email,
+					Password:  user.Password,
+					Nickname:  user.Nickname,
+					Country:   user.Country,
 				})
 				require.NoError(t, err)
 				require.NotEmpty(t, body)
@@ -403,10 +849,1260 @@ func TestDeleteUserApi(t *testing.T) {
 
 			recorder := httptest.NewRecorder()
 
-			req, err := http.NewRequest("DELETE", "/users", bytes.NewBuffer(body))
+			req, err := http.NewRequest("PUT", "/users/"+user.ID.String(), bytes.NewBuffer(body))
+			require.NoError(t, err)
+			require.NotEmpty(t, req)
+			if v.ifMatch != "" {
+				req.Header.Set("If-Match", v.ifMatch)
+			}
+
+			v.setupAuth(t, req, server.tokenMaker)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestListUsersApi(t *testing.T) {
+	n := 2
+	users := make([]db.User, n)
+
+	for i := 0; i < n; i++ {
+		users[i] = randomUser()
+	}
+
+	dbParams := db.ListUsersFilteredParams{
+		Limit:  2,
+		Offset: 2,
+	}
+
+	deletedUser := randomUser()
+	deletedUser.DeletedAt = sql.NullTime{Time: time.Now().UTC().Truncate(time.Second), Valid: true}
+	usersWithDeleted := append([]db.User{deletedUser}, users...)
+
+	testCases := []struct {
+		name           string
+		sendEmptyQuery bool
+		query          string
+		includeDeleted bool
+		count          string
+		setupAuth      func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs     func(store *mockdb.MockStore)
+		checkResponse  func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(users, nil)
+				store.EXPECT().CountUsersFiltered(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(int64(7), nil)
+				store.EXPECT().EstimateUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var page offsetPage
+				err := json.Unmarshal(recorder.Body.Bytes(), &page)
+				require.NoError(t, err)
+				require.Equal(t, newUserListResponse(users), page.Items)
+				require.Equal(t, int32(2), page.Page)
+				require.Equal(t, int32(2), page.PageSize)
+				require.Equal(t, int64(7), page.Total)
+				require.False(t, page.TotalEstimated)
+				require.Equal(t, `</users?page_number=1&page_size=2>; rel="first", `+
+					`</users?page_number=1&page_size=2>; rel="prev", `+
+					`</users?page_number=3&page_size=2>; rel="next", `+
+					`</users?page_number=4&page_size=2>; rel="last"`, recorder.Header().Get("Link"))
+			},
+		},
+		{
+			name:           "Include Deleted",
+			includeDeleted: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				params := db.ListUsersFilteredParams{
+					IncludeDeleted: true,
+					Limit:          2,
+					Offset:         2,
+				}
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(usersWithDeleted, nil)
+				store.EXPECT().CountUsersFiltered(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(int64(5), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var page offsetPage
+				err := json.Unmarshal(recorder.Body.Bytes(), &page)
+				require.NoError(t, err)
+				response := page.Items
+				require.Len(t, response, len(usersWithDeleted))
+				require.NotNil(t, response[0].DeletedAt)
+				require.WithinDuration(t, deletedUser.DeletedAt.Time, *response[0].DeletedAt, time.Second)
+				require.Nil(t, response[1].DeletedAt)
+			},
+		},
+		{
+			name: "Bad Request",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			sendEmptyQuery: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Page Size Too Large",
+			query: "?page_size=101&page_number=1",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+			},
+		},
+		{
+			name:  "Page Number Too Large",
+			query: "?page_size=100&page_number=21474837",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+			},
+		},
+		{
+			name: "Unauthorized",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Forbidden",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:           "Estimated Total With Deleted",
+			count:          countEstimated,
+			includeDeleted: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(usersWithDeleted, nil)
+				store.EXPECT().EstimateUsers(gomock.Any(), gomock.Eq(true)).
+					Times(1).
+					Return(int64(1000), nil)
+				store.EXPECT().CountUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var page offsetPage
+				err := json.Unmarshal(recorder.Body.Bytes(), &page)
+				require.NoError(t, err)
+				require.Equal(t, int64(1000), page.Total)
+				require.True(t, page.TotalEstimated)
+			},
+		},
+		{
+			name:  "Estimated Total",
+			count: countEstimated,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(users, nil)
+				store.EXPECT().EstimateUsers(gomock.Any(), gomock.Eq(false)).
+					Times(1).
+					Return(int64(1000000), nil)
+				store.EXPECT().CountUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var page offsetPage
+				err := json.Unmarshal(recorder.Body.Bytes(), &page)
+				require.NoError(t, err)
+				require.Equal(t, int64(1000000), page.Total)
+				require.True(t, page.TotalEstimated)
+				require.Contains(t, recorder.Header().Get("Link"), `</users?count=estimated&page_number=500000&page_size=2>; rel="last"`)
+			},
+		},
+		{
+			name:  "Table Never Analyzed",
+			count: countEstimated,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(users, nil)
+				store.EXPECT().EstimateUsers(gomock.Any(), gomock.Eq(false)).
+					Times(1).
+					Return(int64(-1), nil)
+				store.EXPECT().CountUsersFiltered(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(int64(4), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var page offsetPage
+				err := json.Unmarshal(recorder.Body.Bytes(), &page)
+				require.NoError(t, err)
+				require.Equal(t, int64(4), page.Total)
+				require.False(t, page.TotalEstimated)
+				require.NotContains(t, recorder.Header().Get("Link"), `rel="next"`)
+			},
+		},
+		{
+			name:  "Invalid Count",
+			count: "approximate",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Equal(t, "count", problem.Errors[0].Field)
+			},
+		},
+		{
+			name: "Count Error",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(users, nil)
+				store.EXPECT().CountUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "Internal Server Error",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return([]db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			url := "/users"
+			if v.query != "" {
+				url += v.query
+			} else if !v.sendEmptyQuery {
+				url += "?page_size=2&page_number=2"
+			}
+			if v.includeDeleted {
+				url += "&include_deleted=true"
+			}
+			if v.count != "" {
+				url += "&count=" + v.count
+			}
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("GET", url, nil)
 			require.NoError(t, err)
 			require.NotEmpty(t, req)
 
+			v.setupAuth(t, req, server.tokenMaker)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestListUsersByCursorApi(t *testing.T) {
+	n := 3
+	users := make([]db.User, n)
+	for i := 0; i < n; i++ {
+		users[i] = randomUser()
+		users[i].CreatedAt = time.Now().UTC().Add(time.Duration(i) * time.Second)
+	}
+	after := encodeUserCursor(users[0])
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "First Page",
+			query: "limit=2",
+			buildStubs: func(store *mockdb.MockStore) {
+				params := db.ListUsersFilteredParams{Limit: 3}
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(users, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var page cursorPage
+				err := json.Unmarshal(recorder.Body.Bytes(), &page)
+				require.NoError(t, err)
+				require.Equal(t, newUserListResponse(users[:2]), page.Items)
+				require.NotNil(t, page.NextCursor)
+				require.Equal(t, encodeUserCursor(users[1]), *page.NextCursor)
+				require.Contains(t, recorder.Header().Get("Link"), `rel="next"`)
+			},
+		},
+		{
+			name:  "Next Page",
+			query: "limit=2&after=" + after,
+			buildStubs: func(store *mockdb.MockStore) {
+				params := db.ListUsersFilteredParams{
+					AfterCreatedAt: users[0].CreatedAt,
+					AfterID:        users[0].ID,
+					Limit:          3,
+				}
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ListUsersFilteredParams) ([]db.User, error) {
+						require.True(t, params.AfterCreatedAt.Equal(arg.AfterCreatedAt))
+						require.Equal(t, params.AfterID, arg.AfterID)
+						require.Equal(t, params.Limit, arg.Limit)
+						return users[1:], nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"next_cursor":null`)
+
+				var page cursorPage
+				err := json.Unmarshal(recorder.Body.Bytes(), &page)
+				require.NoError(t, err)
+				require.Len(t, page.Items, 2)
+				require.Nil(t, page.NextCursor)
+			},
+		},
+		{
+			name:  "Default Limit",
+			query: "after=" + after,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ListUsersFilteredParams) ([]db.User, error) {
+						require.Equal(t, int32(defaultCursorLimit+1), arg.Limit)
+						return []db.User{}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"items":[]`)
+			},
+		},
+		{
+			name:  "Include Deleted",
+			query: "limit=2&include_deleted=true",
+			buildStubs: func(store *mockdb.MockStore) {
+				params := db.ListUsersFilteredParams{IncludeDeleted: true, Limit: 3}
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(users[:1], nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid Cursor",
+			query: "limit=2&after=bm90LWEtY3Vyc29y",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, "invalid_cursor")
+				require.Equal(t, "after", problem.Errors[0].Field)
+			},
+		},
+		{
+			name:  "Limit Too Large",
+			query: "limit=101",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Equal(t, "limit", problem.Errors[0].Field)
+			},
+		},
+		{
+			name:  "Internal Server Error",
+			query: "limit=2",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("GET", "/users?"+v.query, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestDeleteUserApi(t *testing.T) {
+	user := randomUser()
+	dbParams := db.DeleteUserParams{
+		ID:      user.ID,
+		Version: user.Version,
+	}
+
+	testCases := []struct {
+		name          string
+		sendInvalidID bool
+		ifMatch       string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "OK",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "Any ETag",
+			ifMatch: "*",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "Bad Request",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			sendInvalidID: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Precondition Required",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionRequired, "precondition_required")
+			},
+		},
+		{
+			name:    "Precondition Failed",
+			ifMatch: `"stale"`,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionFailed, "precondition_failed")
+			},
+		},
+		{
+			name:    "Concurrent Update",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusPreconditionFailed, "precondition_failed")
+			},
+		},
+		{
+			name:    "Not Found",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusNotFound, apperror.CodeNotFound)
+			},
+		},
+		{
+			name:    "Unauthorized",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:    "Forbidden",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:    "Admin",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "Internal Server Error",
+			ifMatch: userETag(user),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().DeleteUser(gomock.Any(), gomock.Eq(dbParams)).
+					Times(1).
+					Return(int64(0), sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			url := "/users/" + user.ID.String()
+			if v.sendInvalidID {
+				url = "/users/not-a-uuid"
+			}
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("DELETE", url, nil)
+			require.NoError(t, err)
+			require.NotEmpty(t, req)
+			if v.ifMatch != "" {
+				req.Header.Set("If-Match", v.ifMatch)
+			}
+
+			v.setupAuth(t, req, server.tokenMaker)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestRestoreUserApi(t *testing.T) {
+	user := randomUser()
+
+	testCases := []struct {
+		name          string
+		sendInvalidID bool
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RestoreUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchUser(t, recorder.Body, &user)
+			},
+		},
+		{
+			name: "Bad Request",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			sendInvalidID: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RestoreUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Not Found",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RestoreUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusNotFound, apperror.CodeNotFound)
+			},
+		},
+		{
+			name: "Forbidden",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RestoreUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "Internal Server Error",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RestoreUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			url := "/users/" + user.ID.String() + "/restore"
+			if v.sendInvalidID {
+				url = "/users/not-a-uuid/restore"
+			}
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", url, nil)
+			require.NoError(t, err)
+
+			v.setupAuth(t, req, server.tokenMaker)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLoginUserApi(t *testing.T) {
+	plainPassword := util.RandomWord(10)
+
+	hasher, err := password.NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	hashedPassword, err := hasher.Hash(plainPassword)
+	require.NoError(t, err)
+
+	outdatedHasher, err := password.NewBcryptHasher(bcrypt.MinCost + 1)
+	require.NoError(t, err)
+	outdatedPassword, err := outdatedHasher.Hash(plainPassword)
+	require.NoError(t, err)
+
+	user := randomUser()
+	user.Password = hashedPassword
+
+	outdatedUser := user
+	outdatedUser.Password = outdatedPassword
+
+	// accounts created before passwords were hashed still store them in plaintext
+	plaintextUser := user
+	plaintextUser.Password = plainPassword
+
+	testCases := []struct {
+		name          string
+		body          loginUserRequest
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: loginUserRequest{Login: user.Nickname, Password: plainPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Eq(db.GetUserByLoginParams{Nickname: user.Nickname, Email: user.Nickname})).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().UpdateUserPassword(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]string{util.RoleAdmin}, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.CreateSessionParams) (db.Session, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.NotEmpty(t, arg.RefreshTokenHash)
+						require.False(t, arg.MfaAuthenticated)
+						return db.Session{ID: arg.ID, UserID: arg.UserID}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &loginUserResponse{}
+				err := json.Unmarshal(recorder.Body.Bytes(), response)
+				require.NoError(t, err)
+				require.Equal(t, user.ID, response.User.ID)
+
+				accessPayload, err := server.tokenMaker.VerifyToken(response.AccessToken, token.TypeAccess)
+				require.NoError(t, err)
+				require.Equal(t, user.ID, accessPayload.UserID)
+				// admin role requires MFA, so it is withheld until the user enables it
+				require.Equal(t, []string{util.RoleUser}, accessPayload.Roles)
+
+				refreshPayload, err := server.tokenMaker.VerifyToken(response.RefreshToken, token.TypeRefresh)
+				require.NoError(t, err)
+				require.Equal(t, user.ID, refreshPayload.UserID)
+				require.Equal(t, refreshPayload.ID, response.SessionID)
+			},
+		},
+		{
+			name: "MFA Required",
+			body: loginUserRequest{Login: user.Nickname, Password: plainPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{UserID: user.ID, ConfirmedAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &loginMFAResponse{}
+				err := json.Unmarshal(recorder.Body.Bytes(), response)
+				require.NoError(t, err)
+				require.True(t, response.MFARequired)
+
+				mfaPayload, err := server.tokenMaker.VerifyToken(response.MFAToken, token.TypeMFA)
+				require.NoError(t, err)
+				require.Equal(t, user.ID, mfaPayload.UserID)
+				require.Empty(t, mfaPayload.Roles)
+			},
+		},
+		{
+			name: "Rehash Outdated Password",
+			body: loginUserRequest{Login: strings.ToUpper(user.Email) + " ", Password: plainPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				local, domain := user.Email[:strings.Index(user.Email, "@")], user.Email[strings.Index(user.Email, "@"):]
+				params := db.GetUserByLoginParams{
+					Nickname: strings.ToUpper(user.Email) + " ",
+					Email:    strings.ToUpper(local) + domain,
+				}
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(outdatedUser, nil)
+				store.EXPECT().UpdateUserPassword(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.UpdateUserPasswordParams) error {
+						require.Equal(t, user.ID, arg.ID)
+						require.False(t, hasher.NeedsRehash(arg.Password))
+						require.NoError(t, hasher.Verify(arg.Password, plainPassword))
+						return nil
+					})
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]string{}, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{}, nil)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Rehash Plaintext Password",
+			body: loginUserRequest{Login: user.Nickname, Password: plainPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(plaintextUser, nil)
+				store.EXPECT().UpdateUserPassword(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.UpdateUserPasswordParams) error {
+						require.Equal(t, user.ID, arg.ID)
+						require.NotEqual(t, plainPassword, arg.Password)
+						require.False(t, hasher.NeedsRehash(arg.Password))
+						require.NoError(t, hasher.Verify(arg.Password, plainPassword))
+						return nil
+					})
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]string{}, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{}, nil)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Wrong Plaintext Password",
+			body: loginUserRequest{Login: user.Nickname, Password: util.RandomWord(11)},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(plaintextUser, nil)
+				store.EXPECT().UpdateUserPassword(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+			},
+		},
+		{
+			name: "Bad Request",
+			body: loginUserRequest{Login: user.Nickname},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "User Not Found",
+			body: loginUserRequest{Login: user.Nickname, Password: plainPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Eq(db.GetUserByLoginParams{Nickname: user.Nickname, Email: user.Nickname})).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Wrong Password",
+			body: loginUserRequest{Login: user.Nickname, Password: util.RandomWord(10)},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Eq(db.GetUserByLoginParams{Nickname: user.Nickname, Email: user.Nickname})).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Internal Server Error",
+			body: loginUserRequest{Login: user.Nickname, Password: plainPassword},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Eq(db.GetUserByLoginParams{Nickname: user.Nickname, Email: user.Nickname})).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			body, err := json.Marshal(v.body)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", "/users/login", bytes.NewBuffer(body))
+			require.NoError(t, err)
+			require.NotEmpty(t, req)
+
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, server, recorder)
+		})
+	}
+}
+
+func TestListUsersFilteredApi(t *testing.T) {
+	users := []db.User{randomUser()}
+	createdFrom := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Filters And Sort",
+			query: "page_size=2&page_number=1&country=PL&email_domain=example.com&nickname_prefix=jo" +
+				"&created_from=2022-01-01T01:00:00%2B01:00&sort=-created_at,last_name",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ListUsersFilteredParams) ([]db.User, error) {
+						require.Equal(t, "PL", arg.Country)
+						require.Equal(t, "example.com", arg.EmailDomain)
+						require.Equal(t, "jo", arg.NicknamePrefix)
+						require.True(t, createdFrom.Equal(arg.CreatedFrom))
+						require.True(t, arg.CreatedTo.IsZero())
+						require.Equal(t, []db.UserSort{{Field: "created_at", Descending: true}, {Field: "last_name"}}, arg.Sort)
+						require.Equal(t, int32(2), arg.Limit)
+						require.Zero(t, arg.Offset)
+						return users, nil
+					})
+				store.EXPECT().CountUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), "password")
+
+				var page offsetPage
+				err := json.Unmarshal(recorder.Body.Bytes(), &page)
+				require.NoError(t, err)
+				require.Equal(t, newUserListResponse(users), page.Items)
+			},
+		},
+		{
+			name:  "Estimated Count With Filters",
+			query: "page_size=2&page_number=1&country=PL&count=estimated",
+			buildStubs: func(store *mockdb.MockStore) {
+				params := db.ListUsersFilteredParams{Country: "PL", Limit: 2}
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(users, nil)
+				store.EXPECT().EstimateUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().CountUsersFiltered(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(int64(1), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"total_estimated":false`)
+			},
+		},
+		{
+			name:  "Cursor With Filters",
+			query: "limit=2&country=PL",
+			buildStubs: func(store *mockdb.MockStore) {
+				params := db.ListUsersFilteredParams{Country: "PL", Limit: 3}
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Eq(params)).
+					Times(1).
+					Return(users, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:  "Sort Not Whitelisted",
+			query: "page_size=2&page_number=1&sort=password",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, codeInvalidSort)
+				require.Equal(t, "sort", problem.Errors[0].Field)
+			},
+		},
+		{
+			name:  "Sort Injection",
+			query: "page_size=2&page_number=1&sort=id%3B%20DROP%20TABLE%20users",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, codeInvalidSort)
+			},
+		},
+		{
+			name:  "Sort With Cursor",
+			query: "limit=2&sort=last_name",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, codeInvalidSort)
+			},
+		},
+		{
+			name:  "Invalid Time Range",
+			query: "page_size=2&page_number=1&created_from=2022-01-02T00:00:00Z&created_to=2022-01-01T00:00:00Z",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Equal(t, "created_to", problem.Errors[0].Field)
+			},
+		},
+		{
+			name:  "Invalid Time",
+			query: "page_size=2&page_number=1&modified_from=yesterday",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid Email Domain",
+			query: "page_size=2&page_number=1&email_domain=%25",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListUsersFiltered(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				problem := requireProblem(t, recorder, http.StatusBadRequest, apperror.CodeValidationFailed)
+				require.Equal(t, "email_domain", problem.Errors[0].Field)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("GET", "/users?"+v.query, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, req, server.tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
 			server.router.ServeHTTP(recorder, req)
 
 			v.checkResponse(t, recorder)
@@ -1,3 +1,56 @@
 package api
 
-// @TODO write validator function for countries
+import (
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/rafdekar/user-api/country"
+	"github.com/rafdekar/user-api/util"
+	"reflect"
+	"strings"
+)
+
+// tagISO3166Alpha2 validates ISO 3166-1 alpha-2 country codes, the code is accepted in any case
+// and handlers store it upper cased
+const tagISO3166Alpha2 = "iso3166_alpha2"
+
+// registerValidators configures validator used by gin bindings, limits of name lengths are taken from config
+func registerValidators(config util.Config) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return nil
+	}
+
+	v.RegisterTagNameFunc(fieldName)
+
+	validations := map[string]validator.Func{
+		tagISO3166Alpha2: validateISO3166Alpha2,
+		tagPersonalName:  validatePersonalName,
+		tagNameLength:    nameLengthValidator(config.NameMinLength, config.NameMaxLength),
+	}
+	for tag, fn := range validations {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			return fmt.Errorf("could not register %s validator: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+// fieldName returns name of the field as seen by the client, so that validation errors refer to request
+// members instead of Go struct fields
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form", "uri"} {
+		name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+// validateISO3166Alpha2 checks that the field is an assigned ISO 3166-1 alpha-2 code
+func validateISO3166Alpha2(fl validator.FieldLevel) bool {
+	return country.IsAlpha2(fl.Field().String())
+}
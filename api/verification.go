@@ -0,0 +1,147 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rafdekar/user-api/apperror"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/mail"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// linkTokenSize is the number of random bytes of tokens sent in links, e.g. email verification tokens
+const linkTokenSize = 32
+
+var (
+	errEmailAlreadyVerified = apperror.New(apperror.KindConflict, "email_already_verified", "email is already verified")
+	errEmailNotVerified     = apperror.New(apperror.KindForbidden, "email_not_verified", "email has to be verified before logging in")
+	// errInvalidVerificationToken does not tell unknown, used and expired tokens apart
+	errInvalidVerificationToken = apperror.New(apperror.KindInvalid, "invalid_verification_token", "verification token is invalid or expired")
+)
+
+// newLinkToken returns random URL safe token, only its hash is stored
+func newLinkToken() (string, error) {
+	buffer := make([]byte, linkTokenSize)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// tokenLink appends the token to the base URL, the URLs from config were validated by NewServer
+func tokenLink(baseURL string, linkToken string) string {
+	link, _ := url.Parse(baseURL)
+	query := link.Query()
+	query.Set("token", linkToken)
+	link.RawQuery = query.Encode()
+
+	return link.String()
+}
+
+// sendVerificationEmail creates a new verification token for the current address of the user and mails the link
+// with it, tokens sent before stay valid until they expire
+func (s *Server) sendVerificationEmail(ctx *gin.Context, user db.User) error {
+	verificationToken, err := newLinkToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.store.CreateEmailVerificationToken(ctx, db.CreateEmailVerificationTokenParams{
+		TokenHash: hashToken(verificationToken),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(s.config.EmailVerificationTokenDuration).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nplease verify your email address by opening the link below, it expires in %s.\n\n%s\n",
+			user.FirstName, s.config.EmailVerificationTokenDuration, tokenLink(s.config.EmailVerificationURL, verificationToken),
+		),
+	})
+}
+
+// sendEmailVerification defines endpoint for sending the verification link again, e.g. after the previous one expired
+func (s *Server) sendEmailVerification(ctx *gin.Context) {
+	id, ok := bindUserID(ctx)
+	if !ok {
+		return
+	}
+
+	if !sendEmailVerificationPolicy.allows(authorizationPayload(ctx), id) {
+		respondWithError(ctx, errForbidden)
+		return
+	}
+
+	user, err := s.store.GetUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errUserNotFound)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(ctx, errEmailAlreadyVerified)
+		return
+	}
+
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{})
+}
+
+type verifyEmailRequest struct {
+	Token string `form:"token" binding:"required"`
+}
+
+type verifyEmailResponse struct {
+	Email           string    `json:"email"`
+	EmailVerifiedAt time.Time `json:"email_verified_at"`
+}
+
+// verifyEmail defines endpoint the verification link points to, the token authenticates the request
+// so it does not require logging in
+func (s *Server) verifyEmail(ctx *gin.Context) {
+	request := &verifyEmailRequest{}
+	if err := ctx.ShouldBindQuery(request); err != nil {
+		respondWithError(ctx, apperror.Invalid(err))
+		return
+	}
+
+	// expiry of the token was set in UTC here, now() of the database session may be in another time zone
+	user, err := s.store.VerifyEmail(ctx, db.VerifyEmailParams{
+		TokenHash:  hashToken(request.Token),
+		VerifiedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(ctx, errInvalidVerificationToken)
+			return
+		}
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, verifyEmailResponse{
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt.Time,
+	})
+}
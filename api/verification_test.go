@@ -0,0 +1,462 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/mail"
+	"github.com/rafdekar/user-api/password"
+	"github.com/rafdekar/user-api/token"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// requireTokenEmail checks that the only sent message went to the address and returns the token
+// from the link to baseURL it contains
+func requireTokenEmail(t *testing.T, server *Server, address string, baseURL string) string {
+	messages := server.mailer.(*mail.MemoryMailer).Messages()
+	require.Len(t, messages, 1)
+	require.Equal(t, address, messages[0].To)
+
+	pattern := regexp.MustCompile(regexp.QuoteMeta(baseURL) + `\?token=\S+`)
+	link, err := url.Parse(pattern.FindString(messages[0].Body))
+	require.NoError(t, err)
+	linkToken := link.Query().Get("token")
+	require.NotEmpty(t, linkToken)
+
+	return linkToken
+}
+
+// expectVerificationToken stubs CreateEmailVerificationToken and stores its parameters into params
+func expectVerificationToken(t *testing.T, store *mockdb.MockStore, user db.User, params *db.CreateEmailVerificationTokenParams) {
+	store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.CreateEmailVerificationTokenParams) (db.EmailVerificationToken, error) {
+			require.Equal(t, user.ID, arg.UserID)
+			require.Equal(t, user.Email, arg.Email)
+			require.WithinDuration(t, time.Now().Add(time.Hour), arg.ExpiresAt, time.Minute)
+			*params = arg
+			return db.EmailVerificationToken{TokenHash: arg.TokenHash, UserID: arg.UserID, Email: arg.Email}, nil
+		})
+}
+
+func TestCreateUserVerificationEmailApi(t *testing.T) {
+	user := randomUser()
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams)
+		checkResponse func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(user, nil)
+				expectVerificationToken(t, store, user, params)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				verificationToken := requireTokenEmail(t, server, user.Email, server.config.EmailVerificationURL)
+				require.Equal(t, hashToken(verificationToken), params.TokenHash)
+			},
+		},
+		{
+			name: "Token Not Stored",
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.EmailVerificationToken{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchUser(t, recorder.Body, &user)
+				require.Empty(t, server.mailer.(*mail.MemoryMailer).Messages())
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			params := db.CreateEmailVerificationTokenParams{}
+			v.buildStubs(store, &params)
+
+			body, err := json.Marshal(createUserRequest{
+				FirstName: user.FirstName,
+				LastName:  user.LastName,
+				Nickname:  user.Nickname,
+				Password:  user.Password,
+				Email:     user.Email,
+				Country:   user.Country,
+			})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", "/users", bytes.NewBuffer(body))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, server, recorder, params)
+		})
+	}
+}
+
+func TestSendEmailVerificationApi(t *testing.T) {
+	user := randomUser()
+
+	verifiedUser := user
+	verifiedUser.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	testCases := []struct {
+		name          string
+		sendInvalidID bool
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams)
+		checkResponse func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams)
+	}{
+		{
+			name: "OK",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				expectVerificationToken(t, store, user, params)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+
+				verificationToken := requireTokenEmail(t, server, user.Email, server.config.EmailVerificationURL)
+				require.Equal(t, hashToken(verificationToken), params.TokenHash)
+				require.NotEqual(t, verificationToken, params.TokenHash)
+			},
+		},
+		{
+			name: "Admin",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleAdmin}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				expectVerificationToken(t, store, user, params)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+				requireTokenEmail(t, server, user.Email, server.config.EmailVerificationURL)
+			},
+		},
+		{
+			name: "Already Verified",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(verifiedUser, nil)
+				store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				requireProblem(t, recorder, http.StatusConflict, "email_already_verified")
+				require.Empty(t, server.mailer.(*mail.MemoryMailer).Messages())
+			},
+		},
+		{
+			name:          "Bad Request",
+			sendInvalidID: true,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:      "Unauthorized",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Forbidden",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, uuid.New(), []string{util.RoleUser, util.RoleSupport}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				requireProblem(t, recorder, http.StatusForbidden, "forbidden")
+			},
+		},
+		{
+			name: "Not Found",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Internal Server Error",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, []string{util.RoleUser}, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore, params *db.CreateEmailVerificationTokenParams) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.EmailVerificationToken{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder, params db.CreateEmailVerificationTokenParams) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				require.Empty(t, server.mailer.(*mail.MemoryMailer).Messages())
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			params := db.CreateEmailVerificationTokenParams{}
+			v.buildStubs(store, &params)
+
+			target := "/users/" + user.ID.String() + "/verify-email/send"
+			if v.sendInvalidID {
+				target = "/users/not-a-uuid/verify-email/send"
+			}
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", target, nil)
+			require.NoError(t, err)
+
+			v.setupAuth(t, req, server.tokenMaker)
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, server, recorder, params)
+		})
+	}
+}
+
+func TestVerifyEmailApi(t *testing.T) {
+	verificationToken, err := newLinkToken()
+	require.NoError(t, err)
+
+	user := randomUser()
+	user.EmailVerifiedAt = sql.NullTime{Time: time.Now().UTC().Truncate(time.Second), Valid: true}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?token=" + verificationToken,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().VerifyEmail(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.VerifyEmailParams) (db.User, error) {
+						require.Equal(t, hashToken(verificationToken), arg.TokenHash)
+						require.WithinDuration(t, time.Now().UTC(), arg.VerifiedAt, time.Minute)
+						require.Equal(t, time.UTC, arg.VerifiedAt.Location())
+						return user, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				response := &verifyEmailResponse{}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), response))
+				require.Equal(t, user.Email, response.Email)
+				require.True(t, user.EmailVerifiedAt.Time.Equal(response.EmailVerifiedAt))
+			},
+		},
+		{
+			name:  "Missing Token",
+			query: "",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().VerifyEmail(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid Token",
+			query: "?token=" + verificationToken,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().VerifyEmail(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusBadRequest, "invalid_verification_token")
+			},
+		},
+		{
+			name:  "Internal Server Error",
+			query: "?token=" + verificationToken,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().VerifyEmail(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			v.buildStubs(store)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("GET", "/verify-email"+v.query, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLoginUnverifiedUserApi(t *testing.T) {
+	plainPassword := util.RandomWord(10)
+
+	hasher, err := password.NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	hashedPassword, err := hasher.Hash(plainPassword)
+	require.NoError(t, err)
+
+	user := randomUser()
+	user.Password = hashedPassword
+
+	verifiedUser := user
+	verifiedUser.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Verified",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(verifiedUser, nil)
+				store.EXPECT().GetUserMFA(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.UserMfa{}, sql.ErrNoRows)
+				store.EXPECT().ListUserRoles(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]string{}, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{ID: uuid.New(), UserID: user.ID}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Unverified",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireProblem(t, recorder, http.StatusForbidden, "email_not_verified")
+			},
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+			server.config.EmailVerificationRequired = true
+
+			v.buildStubs(store)
+
+			body, err := json.Marshal(loginUserRequest{Login: user.Nickname, Password: plainPassword})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", "/users/login", bytes.NewBuffer(body))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, req)
+
+			v.checkResponse(t, recorder)
+		})
+	}
+}
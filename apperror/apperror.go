@@ -0,0 +1,134 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind is a category of the error, transport layer decides how to represent it, e.g. which HTTP status to use
+type Kind string
+
+// Kinds of errors
+const (
+	KindInvalid              Kind = "invalid"
+	KindUnauthorized         Kind = "unauthorized"
+	KindForbidden            Kind = "forbidden"
+	KindNotFound             Kind = "not_found"
+	KindConflict             Kind = "conflict"
+	KindPreconditionFailed   Kind = "precondition_failed"
+	KindPreconditionRequired Kind = "precondition_required"
+	KindUnprocessable        Kind = "unprocessable"
+	KindUnsupportedMediaType Kind = "unsupported_media_type"
+	KindTooManyRequests      Kind = "too_many_requests"
+	KindInternal             Kind = "internal"
+)
+
+// Stable machine-readable codes of the errors which are not specific to a single endpoint
+const (
+	CodeValidationFailed     = "validation_failed"
+	CodeMalformedRequest     = "malformed_request"
+	CodeNotFound             = "not_found"
+	CodeUniqueViolation      = "unique_violation"
+	CodeForeignKeyViolation  = "foreign_key_violation"
+	CodeCheckViolation       = "check_violation"
+	CodeNotNullViolation     = "not_null_violation"
+	CodeSerializationFailure = "serialization_failure"
+	CodeInternal             = "internal_error"
+)
+
+// FieldError describes why a single field of the input is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a typed domain error, its Message is safe to be shown to clients while Err is kept for logging only
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// New creates a new Error
+func New(kind Kind, code string, message string) *Error {
+	return &Error{
+		Kind:    kind,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// Newf creates a new Error with formatted message
+func Newf(kind Kind, code string, format string, args ...interface{}) *Error {
+	return New(kind, code, fmt.Sprintf(format, args...))
+}
+
+// Wrap creates a new Error caused by err
+func Wrap(err error, kind Kind, code string, message string) *Error {
+	return &Error{
+		Kind:    kind,
+		Code:    code,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// Error returns the message, including the cause if there is any
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+
+	return e.Message
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an Error of the same kind and code, so that Errors can be used as sentinels
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+
+	return e.Kind == t.Kind && e.Code == t.Code
+}
+
+// Classify converts any error into Error, errors which are not recognised become internal errors
+func Classify(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	if classified := classifyDB(err); classified != nil {
+		return classified
+	}
+
+	if classified := classifyValidation(err); classified != nil {
+		return classified
+	}
+
+	return Wrap(err, KindInternal, CodeInternal, "internal server error")
+}
+
+// Invalid converts error of parsing or validating the input into Error, unlike Classify it never returns
+// an internal error
+func Invalid(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	if classified := classifyValidation(err); classified != nil {
+		return classified
+	}
+
+	return Wrap(err, KindInvalid, CodeMalformedRequest, "request is malformed")
+}
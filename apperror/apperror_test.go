@@ -0,0 +1,143 @@
+package apperror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	type request struct {
+		Email string `validate:"required,email"`
+	}
+	validationErr := validator.New().Struct(request{Email: "not an email"})
+	require.Error(t, validationErr)
+
+	sentinel := New(KindForbidden, "forbidden", "not allowed")
+
+	testCases := []struct {
+		name   string
+		err    error
+		kind   Kind
+		code   string
+		fields []FieldError
+	}{
+		{
+			name: "No Rows",
+			err:  fmt.Errorf("get user: %w", sql.ErrNoRows),
+			kind: KindNotFound,
+			code: CodeNotFound,
+		},
+		{
+			name: "Unique Violation",
+			err:  &pq.Error{Code: "23505", Detail: "Key (nickname)=(john) already exists."},
+			kind: KindConflict,
+			code: CodeUniqueViolation,
+			fields: []FieldError{
+				{Field: "nickname", Code: CodeUniqueViolation, Message: "is already taken"},
+			},
+		},
+		{
+			name: "Unique Violation Of Functional Index",
+			err:  &pq.Error{Code: "23505", Detail: "Key (lower(email::text))=(bob@x.com) already exists."},
+			kind: KindConflict,
+			code: CodeUniqueViolation,
+			fields: []FieldError{
+				{Field: "email", Code: CodeUniqueViolation, Message: "is already taken"},
+			},
+		},
+		{
+			name: "Unique Violation Of Composite Key",
+			err:  &pq.Error{Code: "23505", Detail: "Key (user_id, role)=(1, admin) already exists."},
+			kind: KindConflict,
+			code: CodeUniqueViolation,
+			fields: []FieldError{
+				{Field: "user_id, role", Code: CodeUniqueViolation, Message: "is already taken"},
+			},
+		},
+		{
+			name: "Foreign Key Violation",
+			err:  &pq.Error{Code: "23503", Detail: `Key (role)=(owner) is not present in table "roles".`},
+			kind: KindConflict,
+			code: CodeForeignKeyViolation,
+			fields: []FieldError{
+				{Field: "role", Code: CodeForeignKeyViolation, Message: "references missing resource"},
+			},
+		},
+		{
+			name: "Check Violation",
+			err:  &pq.Error{Code: "23514", Constraint: "users_country_check"},
+			kind: KindInvalid,
+			code: CodeCheckViolation,
+		},
+		{
+			name: "Serialization Failure",
+			err:  &pq.Error{Code: "40001"},
+			kind: KindConflict,
+			code: CodeSerializationFailure,
+		},
+		{
+			name: "Validation",
+			err:  validationErr,
+			kind: KindInvalid,
+			code: CodeValidationFailed,
+			fields: []FieldError{
+				{Field: "Email", Code: "email", Message: "must be a valid email address"},
+			},
+		},
+		{
+			name: "Malformed JSON",
+			err:  json.Unmarshal([]byte("{"), &request{}),
+			kind: KindInvalid,
+			code: CodeMalformedRequest,
+		},
+		{
+			name: "Wrapped Domain Error",
+			err:  fmt.Errorf("context: %w", sentinel),
+			kind: KindForbidden,
+			code: "forbidden",
+		},
+		{
+			name: "Unknown Postgres Error",
+			err:  &pq.Error{Code: "53300"},
+			kind: KindInternal,
+			code: CodeInternal,
+		},
+		{
+			name: "Unknown",
+			err:  errors.New("boom"),
+			kind: KindInternal,
+			code: CodeInternal,
+		},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			appErr := Classify(v.err)
+			require.Equal(t, v.kind, appErr.Kind)
+			require.Equal(t, v.code, appErr.Code)
+			require.Equal(t, v.fields, appErr.Fields)
+			require.NotEmpty(t, appErr.Message)
+		})
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	appErr := Invalid(errors.New("strconv.ParseInt: parsing \"x\": invalid syntax"))
+	require.Equal(t, KindInvalid, appErr.Kind)
+	require.Equal(t, CodeMalformedRequest, appErr.Code)
+	require.NotContains(t, appErr.Message, "strconv")
+}
+
+func TestErrorIs(t *testing.T) {
+	sentinel := New(KindUnprocessable, "unprocessable_patch", "patch can not be applied")
+	detailed := Newf(KindUnprocessable, "unprocessable_patch", "unknown field %q", "id")
+
+	require.True(t, errors.Is(detailed, sentinel))
+	require.False(t, errors.Is(New(KindConflict, "patch_test_failed", "test failed"), sentinel))
+	require.ErrorIs(t, Wrap(sql.ErrNoRows, KindNotFound, CodeNotFound, "not found"), sql.ErrNoRows)
+}
@@ -0,0 +1,79 @@
+package apperror
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"regexp"
+)
+
+// SQLSTATE codes of the classified Postgres errors
+const (
+	pqUniqueViolation      = "23505"
+	pqForeignKeyViolation  = "23503"
+	pqCheckViolation       = "23514"
+	pqNotNullViolation     = "23502"
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+)
+
+// keyDetail matches the column list of "Key (nickname)=(value) already exists." details
+var keyDetail = regexp.MustCompile(`^Key \((.+?)\)=\(`)
+
+// keyExpression matches keys of functional indexes such as "lower(email::text)"
+var keyExpression = regexp.MustCompile(`^\w+\((\w+)(?:::\w+)?\)$`)
+
+// classifyDB converts sql.ErrNoRows and *pq.Error into Error, it returns nil for other errors
+func classifyDB(err error) *Error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return Wrap(err, KindNotFound, CodeNotFound, "resource not found")
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil
+	}
+
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		classified := Wrap(err, KindConflict, CodeUniqueViolation, "resource already exists")
+		if field := keyField(pqErr); field != "" {
+			classified.Message = field + " is already taken"
+			classified.Fields = []FieldError{{Field: field, Code: CodeUniqueViolation, Message: "is already taken"}}
+		}
+		return classified
+	case pqForeignKeyViolation:
+		classified := Wrap(err, KindConflict, CodeForeignKeyViolation, "referenced resource does not exist or is still referenced")
+		if field := keyField(pqErr); field != "" {
+			classified.Fields = []FieldError{{Field: field, Code: CodeForeignKeyViolation, Message: "references missing resource"}}
+		}
+		return classified
+	case pqCheckViolation:
+		return Wrap(err, KindInvalid, CodeCheckViolation, "resource violates constraint "+pqErr.Constraint)
+	case pqNotNullViolation:
+		classified := Wrap(err, KindInvalid, CodeNotNullViolation, "required field is missing")
+		if pqErr.Column != "" {
+			classified.Fields = []FieldError{{Field: pqErr.Column, Code: CodeNotNullViolation, Message: "is required"}}
+		}
+		return classified
+	case pqSerializationFailure, pqDeadlockDetected:
+		return Wrap(err, KindConflict, CodeSerializationFailure, "resource was modified concurrently, retry the request")
+	}
+
+	return nil
+}
+
+// keyField returns the column which violated a key constraint, multi-column keys are returned as listed by Postgres
+// and keys of functional indexes over a single column are reported as the column
+func keyField(pqErr *pq.Error) string {
+	matches := keyDetail.FindStringSubmatch(pqErr.Detail)
+	if len(matches) != 2 {
+		return ""
+	}
+
+	if expression := keyExpression.FindStringSubmatch(matches[1]); len(expression) == 2 {
+		return expression[1]
+	}
+
+	return matches[1]
+}
@@ -0,0 +1,80 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"strings"
+)
+
+// classifyValidation converts validator and JSON decoding errors into Error, it returns nil for other errors
+func classifyValidation(err error) *Error {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		classified := Wrap(err, KindInvalid, CodeValidationFailed, "request validation failed")
+		for _, fieldErr := range validationErrs {
+			classified.Fields = append(classified.Fields, FieldError{
+				Field:   fieldErr.Field(),
+				Code:    fieldErr.Tag(),
+				Message: validationMessage(fieldErr),
+			})
+		}
+		return classified
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return Wrap(err, KindInvalid, CodeMalformedRequest, "request body is not valid JSON")
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		classified := Wrap(err, KindInvalid, CodeMalformedRequest, "request body has invalid type of value")
+		if typeErr.Field != "" {
+			classified.Fields = []FieldError{{
+				Field:   typeErr.Field,
+				Code:    "type",
+				Message: "must be " + typeErr.Type.String(),
+			}}
+		}
+		return classified
+	}
+
+	return nil
+}
+
+// validationMessage describes failed validation rule in a way which doesn't depend on the Go type of the field
+func validationMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "alpha":
+		return "must contain only letters"
+	case "uuid":
+		return "must be a valid UUID"
+	case "len":
+		return fmt.Sprintf("must have exactly %s characters", fieldErr.Param())
+	case "min":
+		return "must be at least " + fieldErr.Param()
+	case "max":
+		return "must be at most " + fieldErr.Param()
+	case "personal_name":
+		return "must contain only letters, apostrophes, hyphens and spaces between words"
+	case "name_length":
+		return "has too few or too many characters"
+	case "iso3166_alpha2":
+		return "must be an ISO 3166-1 alpha-2 country code"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fieldErr.Param()), ", ")
+	}
+
+	if fieldErr.Param() != "" {
+		return fmt.Sprintf("failed %q validation with %q", fieldErr.Tag(), fieldErr.Param())
+	}
+
+	return fmt.Sprintf("failed %q validation", fieldErr.Tag())
+}
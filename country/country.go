@@ -0,0 +1,87 @@
+// Package country provides ISO 3166-1 reference data of countries
+package country
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// countriesCSV lists all officially assigned ISO 3166-1 codes ordered by alpha-2 code
+//
+//go:embed countries.csv
+var countriesCSV string
+
+// Country is an entry of ISO 3166-1
+type Country struct {
+	Alpha2  string `json:"alpha2"`
+	Alpha3  string `json:"alpha3"`
+	Numeric string `json:"numeric"`
+	Name    string `json:"name"`
+}
+
+var (
+	countries []Country
+	byAlpha2  map[string]Country
+)
+
+func init() {
+	var err error
+	countries, err = parse(countriesCSV)
+	if err != nil {
+		panic(err)
+	}
+
+	byAlpha2 = make(map[string]Country, len(countries))
+	for _, c := range countries {
+		byAlpha2[c.Alpha2] = c
+	}
+}
+
+// parse reads the embedded table, the first line is a header
+func parse(data string) ([]Country, error) {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not read countries: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("countries table is empty")
+	}
+
+	result := make([]Country, 0, len(records)-1)
+	for _, record := range records[1:] {
+		result = append(result, Country{
+			Alpha2:  record[0],
+			Alpha3:  record[1],
+			Numeric: record[2],
+			Name:    record[3],
+		})
+	}
+
+	return result, nil
+}
+
+// All returns all countries ordered by alpha-2 code, the slice is a copy and can be modified
+func All() []Country {
+	result := make([]Country, len(countries))
+	copy(result, countries)
+	return result
+}
+
+// Normalize converts alpha-2 code into its canonical upper case form
+func Normalize(code string) string {
+	return strings.ToUpper(code)
+}
+
+// Lookup finds the country by alpha-2 code, the code is matched case-insensitively
+func Lookup(code string) (Country, bool) {
+	c, ok := byAlpha2[Normalize(code)]
+	return c, ok
+}
+
+// IsAlpha2 reports whether the code is an assigned ISO 3166-1 alpha-2 code in any case
+func IsAlpha2(code string) bool {
+	_, ok := Lookup(code)
+	return ok
+}
@@ -0,0 +1,43 @@
+package country
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	all := All()
+	require.Len(t, all, 249)
+
+	for i, c := range all {
+		require.Len(t, c.Alpha2, 2)
+		require.Len(t, c.Alpha3, 3)
+		require.Len(t, c.Numeric, 3)
+		require.NotEmpty(t, c.Name)
+		if i > 0 {
+			require.Less(t, all[i-1].Alpha2, c.Alpha2)
+		}
+	}
+
+	all[0].Name = "changed"
+	require.NotEqual(t, "changed", All()[0].Name)
+}
+
+func TestLookup(t *testing.T) {
+	c, ok := Lookup("gb")
+	require.True(t, ok)
+	require.Equal(t, Country{Alpha2: "GB", Alpha3: "GBR", Numeric: "826", Name: "United Kingdom"}, c)
+
+	c, ok = Lookup("Pl")
+	require.True(t, ok)
+	require.Equal(t, "POL", c.Alpha3)
+
+	for _, code := range []string{"UK", "ZZ", "", "POL", "P", " PL"} {
+		require.False(t, IsAlpha2(code), code)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	require.Equal(t, "DE", Normalize("de"))
+	require.Equal(t, "DE", Normalize("De"))
+}
@@ -0,0 +1,16 @@
+CREATE TABLE "roles" (
+                         "name" varchar PRIMARY KEY,
+                         "description" varchar NOT NULL DEFAULT '',
+                         "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "user_roles" (
+                              "user_id" uuid NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+                              "role" varchar NOT NULL REFERENCES "roles" ("name") ON DELETE CASCADE,
+                              "created_at" timestamp NOT NULL DEFAULT (now()),
+                              PRIMARY KEY ("user_id", "role")
+);
+
+INSERT INTO "roles" ("name", "description")
+VALUES ('user', 'Every registered user, can manage only their own account'),
+       ('admin', 'Can list and manage all user accounts');
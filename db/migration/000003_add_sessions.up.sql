@@ -0,0 +1,12 @@
+CREATE TABLE "sessions" (
+                            "id" uuid PRIMARY KEY,
+                            "user_id" uuid NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+                            "refresh_token_hash" varchar NOT NULL,
+                            "user_agent" varchar NOT NULL,
+                            "client_ip" varchar NOT NULL,
+                            "revoked" boolean NOT NULL DEFAULT false,
+                            "expires_at" timestamp NOT NULL,
+                            "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "sessions" ("user_id");
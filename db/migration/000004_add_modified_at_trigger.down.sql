@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS "users_set_modified_at" ON "users";
+DROP FUNCTION IF EXISTS set_modified_at();
@@ -0,0 +1,13 @@
+CREATE OR REPLACE FUNCTION set_modified_at() RETURNS trigger AS $$
+BEGIN
+    NEW.modified_at = now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- updates which do not change anything, e.g. PatchUser without any field, keep the previous modified_at
+CREATE TRIGGER "users_set_modified_at"
+    BEFORE UPDATE ON "users"
+    FOR EACH ROW
+    WHEN (OLD.* IS DISTINCT FROM NEW.*)
+EXECUTE PROCEDURE set_modified_at();
@@ -0,0 +1,3 @@
+ALTER TABLE "users" ADD COLUMN "deleted_at" timestamp;
+
+CREATE INDEX ON "users" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
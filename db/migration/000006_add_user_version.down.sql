@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS "users_increment_version" ON "users";
+DROP FUNCTION IF EXISTS increment_version();
+ALTER TABLE "users" DROP COLUMN IF EXISTS "version";
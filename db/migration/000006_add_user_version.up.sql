@@ -0,0 +1,15 @@
+ALTER TABLE "users" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION increment_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- version is the entity tag of the user, so like modified_at it changes only when the row does
+CREATE TRIGGER "users_increment_version"
+    BEFORE UPDATE ON "users"
+    FOR EACH ROW
+    WHEN (OLD.* IS DISTINCT FROM NEW.*)
+EXECUTE PROCEDURE increment_version();
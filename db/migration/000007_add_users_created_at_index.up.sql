@@ -0,0 +1,2 @@
+-- keyset pagination of users walks this index in (created_at, id) order
+CREATE INDEX "users_created_at_id_idx" ON "users" ("created_at", "id");
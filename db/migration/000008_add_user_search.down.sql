@@ -0,0 +1,11 @@
+DELETE FROM "roles" WHERE "name" = 'support';
+
+DROP INDEX IF EXISTS "users_email_trgm_idx";
+DROP INDEX IF EXISTS "users_nickname_trgm_idx";
+DROP INDEX IF EXISTS "users_last_name_trgm_idx";
+DROP INDEX IF EXISTS "users_first_name_trgm_idx";
+DROP INDEX IF EXISTS "users_search_vector_idx";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "search_vector";
+
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,20 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- names are not stemmed, so the simple configuration is used instead of a language specific one
+ALTER TABLE "users" ADD COLUMN "search_vector" tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', "first_name"), 'A') ||
+    setweight(to_tsvector('simple', "last_name"), 'A') ||
+    setweight(to_tsvector('simple', "nickname"), 'B') ||
+    setweight(to_tsvector('simple', "email"), 'C')
+) STORED;
+
+CREATE INDEX "users_search_vector_idx" ON "users" USING gin ("search_vector");
+
+-- trigram indexes find partial and misspelled values which full-text search misses
+CREATE INDEX "users_first_name_trgm_idx" ON "users" USING gin ("first_name" gin_trgm_ops);
+CREATE INDEX "users_last_name_trgm_idx" ON "users" USING gin ("last_name" gin_trgm_ops);
+CREATE INDEX "users_nickname_trgm_idx" ON "users" USING gin ("nickname" gin_trgm_ops);
+CREATE INDEX "users_email_trgm_idx" ON "users" USING gin ("email" gin_trgm_ops);
+
+INSERT INTO "roles" ("name", "description")
+VALUES ('support', 'Can search user accounts');
@@ -0,0 +1 @@
+-- original case of the codes is not kept, normalized codes are valid for the previous version as well
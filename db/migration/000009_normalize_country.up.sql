@@ -0,0 +1,3 @@
+-- countries are validated as ISO 3166-1 alpha-2 codes, UK is reserved there and the United Kingdom is GB
+UPDATE "users" SET "country" = upper("country") WHERE "country" <> upper("country");
+UPDATE "users" SET "country" = 'GB' WHERE "country" = 'UK';
@@ -0,0 +1,7 @@
+-- addresses are stored trimmed and with lower cased domain, as the API normalizes them
+UPDATE "users"
+SET "email" = substring(trim("email") from '^(.*)@') || '@' || lower(substring(trim("email") from '@([^@]*)$'))
+WHERE position('@' in "email") > 0;
+
+-- fails when two users share an address, such accounts have to be merged or changed before migrating
+CREATE UNIQUE INDEX "users_email_lower_key" ON "users" (lower("email"));
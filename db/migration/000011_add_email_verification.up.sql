@@ -0,0 +1,14 @@
+-- existing users keep unverified addresses, they can request verification like new users
+ALTER TABLE "users" ADD COLUMN "email_verified_at" timestamp;
+
+-- only the hash of the token is stored, the token itself is sent to the verified address
+CREATE TABLE "email_verification_tokens" (
+                                             "token_hash" varchar PRIMARY KEY,
+                                             "user_id" uuid NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+                                             "email" varchar NOT NULL,
+                                             "expires_at" timestamp NOT NULL,
+                                             "used_at" timestamp,
+                                             "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "email_verification_tokens" ("user_id");
@@ -0,0 +1,10 @@
+-- like email verification tokens only the hash is stored, the token itself is sent to the address of the user
+CREATE TABLE "password_reset_tokens" (
+                                         "token_hash" varchar PRIMARY KEY,
+                                         "user_id" uuid NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+                                         "expires_at" timestamp NOT NULL,
+                                         "used_at" timestamp,
+                                         "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "password_reset_tokens" ("user_id");
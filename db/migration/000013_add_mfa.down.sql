@@ -0,0 +1,4 @@
+ALTER TABLE "sessions" DROP COLUMN IF EXISTS "mfa_authenticated";
+
+DROP TABLE IF EXISTS "mfa_recovery_codes";
+DROP TABLE IF EXISTS "user_mfa";
@@ -0,0 +1,21 @@
+-- the secret has to be readable to compute codes, so unlike other tokens it is stored as is. Enrollment is pending
+-- until the first code is confirmed and last_used_counter keeps every code from being used twice
+CREATE TABLE "user_mfa" (
+                            "user_id" uuid PRIMARY KEY REFERENCES "users" ("id") ON DELETE CASCADE,
+                            "secret" varchar NOT NULL,
+                            "confirmed_at" timestamp,
+                            "last_used_counter" bigint NOT NULL DEFAULT 0,
+                            "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "mfa_recovery_codes" (
+                                      "code_hash" varchar PRIMARY KEY,
+                                      "user_id" uuid NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+                                      "used_at" timestamp,
+                                      "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "mfa_recovery_codes" ("user_id");
+
+-- sessions created without the second factor do not get roles which require it
+ALTER TABLE "sessions" ADD COLUMN "mfa_authenticated" boolean NOT NULL DEFAULT false;
@@ -0,0 +1,8 @@
+-- failed logins are counted per key, e.g. an account or a client IP, so that every instance of the server
+-- sees the same failures and locks
+CREATE TABLE "login_attempts" (
+                                  "key" varchar PRIMARY KEY,
+                                  "failures" integer NOT NULL,
+                                  "last_failure_at" timestamp NOT NULL,
+                                  "locked_until" timestamp
+);
@@ -0,0 +1,21 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (
+                                       token_hash,
+                                       user_id,
+                                       email,
+                                       expires_at
+)
+VALUES ($1, $2, $3, $4) RETURNING *;
+
+-- name: VerifyEmail :one
+WITH token AS (
+    UPDATE email_verification_tokens
+    SET used_at = sqlc.arg(verified_at)::timestamp
+    WHERE token_hash = sqlc.arg(token_hash) AND used_at IS NULL AND expires_at > sqlc.arg(verified_at)::timestamp
+    RETURNING user_id, email
+)
+UPDATE users
+SET email_verified_at = COALESCE(users.email_verified_at, sqlc.arg(verified_at)::timestamp)
+FROM token
+WHERE users.id = token.user_id AND users.email = token.email AND users.deleted_at IS NULL
+RETURNING users.*;
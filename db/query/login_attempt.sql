@@ -0,0 +1,32 @@
+-- name: GetLoginAttempt :one
+SELECT * FROM login_attempts
+WHERE key = $1 LIMIT 1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (
+                            key,
+                            failures,
+                            last_failure_at
+)
+VALUES (sqlc.arg(key), 1, sqlc.arg(failed_at))
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure_at < sqlc.arg(reset_before) THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = EXCLUDED.last_failure_at
+RETURNING *;
+
+-- name: LockLoginAttempt :exec
+UPDATE login_attempts
+SET locked_until = GREATEST(locked_until, sqlc.arg(locked_until)::timestamp)
+WHERE key = sqlc.arg(key);
+
+-- name: DeleteLoginAttempt :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+-- name: DeleteStaleLoginAttempts :execrows
+DELETE FROM login_attempts
+WHERE last_failure_at < sqlc.arg(failed_before)::timestamp
+  AND (locked_until IS NULL OR locked_until < sqlc.arg(now)::timestamp);
@@ -0,0 +1,49 @@
+-- name: CreateUserMFA :one
+INSERT INTO user_mfa (
+                      user_id,
+                      secret
+)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret,
+    last_used_counter = 0,
+    created_at = now()
+WHERE user_mfa.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserMFA :one
+SELECT * FROM user_mfa
+WHERE user_id = $1 LIMIT 1;
+
+-- name: ConfirmUserMFA :one
+UPDATE user_mfa
+SET confirmed_at = now(),
+    last_used_counter = $2
+WHERE user_id = $1 AND confirmed_at IS NULL
+RETURNING *;
+
+-- name: UseMFACode :execrows
+UPDATE user_mfa
+SET last_used_counter = $2
+WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_counter < $2;
+
+-- name: DeleteUserMFA :exec
+DELETE FROM user_mfa
+WHERE user_id = $1;
+
+-- name: CreateMFARecoveryCodes :exec
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+SELECT sqlc.arg(user_id), unnest(sqlc.arg(code_hashes)::varchar[]);
+
+-- name: UseMFARecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = now()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountMFARecoveryCodes :one
+SELECT count(*) FROM mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteMFARecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
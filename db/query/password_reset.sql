@@ -0,0 +1,25 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+                                   token_hash,
+                                   user_id,
+                                   expires_at
+)
+VALUES ($1, $2, $3) RETURNING *;
+
+-- name: ResetPassword :one
+WITH token AS (
+    UPDATE password_reset_tokens
+    SET used_at = sqlc.arg(reset_at)::timestamp
+    WHERE token_hash = sqlc.arg(token_hash) AND used_at IS NULL AND expires_at > sqlc.arg(reset_at)::timestamp
+    RETURNING user_id
+)
+UPDATE users
+SET password = sqlc.arg(password)
+FROM token
+WHERE users.id = token.user_id AND users.deleted_at IS NULL
+RETURNING users.*;
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = now()
+WHERE user_id = $1 AND used_at IS NULL;
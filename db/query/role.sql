@@ -0,0 +1,16 @@
+-- name: ListUserRoles :many
+SELECT role FROM user_roles
+WHERE user_id = $1
+ORDER BY role;
+
+-- name: AddUserRole :exec
+INSERT INTO user_roles (
+                        user_id,
+                        role
+)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveUserRole :exec
+DELETE FROM user_roles
+WHERE user_id = $1 AND role = $2;
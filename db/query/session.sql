@@ -0,0 +1,25 @@
+-- name: CreateSession :one
+INSERT INTO sessions (
+                      id,
+                      user_id,
+                      refresh_token_hash,
+                      user_agent,
+                      client_ip,
+                      expires_at,
+                      mfa_authenticated
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions
+WHERE id = $1 LIMIT 1;
+
+-- name: RevokeSession :exec
+UPDATE sessions
+SET revoked = true
+WHERE id = $1;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions
+SET revoked = true
+WHERE user_id = $1 AND revoked = false;
@@ -11,14 +11,59 @@ VALUES ($1, $2, $3, $4, $5, $6) RETURNING *;
 
 -- name: GetUser :one
 SELECT * FROM users
-WHERE id = $1 LIMIT 1;
+WHERE id = $1 AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE lower(email) = lower(sqlc.arg(email)) AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: GetUserByLogin :one
+SELECT * FROM users
+WHERE (nickname = sqlc.arg(nickname) OR lower(email) = lower(sqlc.arg(email))) AND deleted_at IS NULL
+ORDER BY nickname = sqlc.arg(nickname) DESC
+LIMIT 1;
 
 -- name: ListUsers :many
 SELECT * FROM users
+WHERE deleted_at IS NULL
 ORDER BY id
 LIMIT $1
 OFFSET $2;
 
+-- name: SearchUsers :many
+WITH search AS (
+    SELECT websearch_to_tsquery('simple', sqlc.arg(query)::text) AS query,
+           -- matches are marked with private use characters, so that the API can escape the values
+           'HighlightAll=true, StartSel=' || chr(57344) || ', StopSel=' || chr(57345) AS headline_options
+)
+SELECT users.id, users.first_name, users.last_name, users.nickname, users.email, users.country,
+       users.modified_at, users.created_at, users.deleted_at, users.version,
+       (ts_rank(users.search_vector, search.query) + greatest(
+           word_similarity(sqlc.arg(query)::text, users.first_name),
+           word_similarity(sqlc.arg(query)::text, users.last_name),
+           word_similarity(sqlc.arg(query)::text, users.nickname),
+           word_similarity(sqlc.arg(query)::text, users.email)
+       ))::real AS rank,
+       ts_headline('simple', users.first_name, search.query, search.headline_options)::text AS first_name_headline,
+       ts_headline('simple', users.last_name, search.query, search.headline_options)::text AS last_name_headline,
+       ts_headline('simple', users.nickname, search.query, search.headline_options)::text AS nickname_headline,
+       ts_headline('simple', users.email, search.query, search.headline_options)::text AS email_headline,
+       (sqlc.arg(query)::text <% users.first_name)::bool AS first_name_similar,
+       (sqlc.arg(query)::text <% users.last_name)::bool AS last_name_similar,
+       (sqlc.arg(query)::text <% users.nickname)::bool AS nickname_similar,
+       (sqlc.arg(query)::text <% users.email)::bool AS email_similar
+FROM users, search
+WHERE users.deleted_at IS NULL
+  AND (users.search_vector @@ search.query
+    OR sqlc.arg(query)::text <% users.first_name
+    OR sqlc.arg(query)::text <% users.last_name
+    OR sqlc.arg(query)::text <% users.nickname
+    OR sqlc.arg(query)::text <% users.email)
+ORDER BY rank DESC, users.id
+LIMIT sqlc.arg(row_limit)::int;
+
 -- name: UpdateUser :one
 UPDATE users
 SET first_name = $2,
@@ -26,10 +71,44 @@ SET first_name = $2,
     nickname = $4,
     password = $5,
     email = $6,
-    country = $7
-WHERE id = $1
+    country = $7,
+    email_verified_at = CASE WHEN email = $6 THEN email_verified_at END
+WHERE id = $1 AND deleted_at IS NULL AND version = $8
+RETURNING *;
+
+-- name: PatchUser :one
+UPDATE users
+SET first_name = COALESCE(sqlc.narg(first_name), first_name),
+    last_name = COALESCE(sqlc.narg(last_name), last_name),
+    nickname = COALESCE(sqlc.narg(nickname), nickname),
+    password = COALESCE(sqlc.narg(password), password),
+    email = COALESCE(sqlc.narg(email), email),
+    country = COALESCE(sqlc.narg(country), country),
+    email_verified_at = CASE WHEN COALESCE(sqlc.narg(email), email) = email THEN email_verified_at END
+WHERE id = sqlc.arg(id) AND deleted_at IS NULL AND version = sqlc.arg(version)
 RETURNING *;
 
--- name: DeleteUser :exec
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password = $2
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: DeleteUser :execrows
+UPDATE users
+SET deleted_at = now()
+WHERE id = $1 AND deleted_at IS NULL AND version = $2;
+
+-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING *;
+
+-- name: PurgeDeletedUsers :execrows
 DELETE FROM users
-WHERE id = $1;
+WHERE deleted_at < sqlc.arg(deleted_before)::timestamp;
+
+-- name: CountUsersBreakingGmailRules :one
+SELECT count(*) FROM users
+WHERE lower(substring(email from '@([^@]*)$')) IN ('gmail.com', 'googlemail.com')
+  AND email <> replace(lower(split_part(substring(email from '^(.*)@'), '+', 1)), '.', '') || '@gmail.com';
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func createTestEmailVerificationToken(t *testing.T, user *User, expiresAt time.Time) *EmailVerificationToken {
+	params := CreateEmailVerificationTokenParams{
+		TokenHash: util.RandomWordWithNumbers(64),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}
+
+	verificationToken, err := testQueries.CreateEmailVerificationToken(context.Background(), params)
+	require.NoError(t, err)
+
+	require.Equal(t, params.TokenHash, verificationToken.TokenHash)
+	require.Equal(t, params.UserID, verificationToken.UserID)
+	require.Equal(t, params.Email, verificationToken.Email)
+	require.WithinDuration(t, params.ExpiresAt, verificationToken.ExpiresAt, time.Second)
+	require.False(t, verificationToken.UsedAt.Valid)
+
+	return &verificationToken
+}
+
+func TestCreateEmailVerificationToken(t *testing.T) {
+	createTestEmailVerificationToken(t, createTestUser(t), time.Now().Add(time.Hour))
+}
+
+func TestVerifyEmail(t *testing.T) {
+	user := createTestUser(t)
+	require.False(t, user.EmailVerifiedAt.Valid)
+	verificationToken := createTestEmailVerificationToken(t, user, time.Now().Add(time.Hour))
+
+	result, err := testQueries.VerifyEmail(context.Background(), VerifyEmailParams{TokenHash: verificationToken.TokenHash, VerifiedAt: time.Now().UTC()})
+	require.NoError(t, err)
+	require.Equal(t, user.ID, result.ID)
+	require.True(t, result.EmailVerifiedAt.Valid)
+	require.Equal(t, user.Version+1, result.Version)
+
+	// tokens can be used only once
+	_, err = testQueries.VerifyEmail(context.Background(), VerifyEmailParams{TokenHash: verificationToken.TokenHash, VerifiedAt: time.Now().UTC()})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestVerifyEmailExpired(t *testing.T) {
+	user := createTestUser(t)
+	verificationToken := createTestEmailVerificationToken(t, user, time.Now().Add(-time.Minute))
+
+	_, err := testQueries.VerifyEmail(context.Background(), VerifyEmailParams{TokenHash: verificationToken.TokenHash, VerifiedAt: time.Now().UTC()})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestVerifyEmailExpiresAtGivenTime(t *testing.T) {
+	user := createTestUser(t)
+	verificationToken := createTestEmailVerificationToken(t, user, time.Now().Add(time.Hour))
+
+	// expiry is compared with the time passed in rather than the clock of the database session
+	_, err := testQueries.VerifyEmail(context.Background(), VerifyEmailParams{
+		TokenHash:  verificationToken.TokenHash,
+		VerifiedAt: time.Now().Add(2 * time.Hour).UTC(),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestVerifyEmailChanged(t *testing.T) {
+	user := createTestUser(t)
+	verificationToken := createTestEmailVerificationToken(t, user, time.Now().Add(time.Hour))
+
+	_, err := testQueries.PatchUser(context.Background(), PatchUserParams{
+		ID:      user.ID,
+		Version: user.Version,
+		Email:   sql.NullString{String: util.RandomEmail(), Valid: true},
+	})
+	require.NoError(t, err)
+
+	_, err = testQueries.VerifyEmail(context.Background(), VerifyEmailParams{TokenHash: verificationToken.TokenHash, VerifiedAt: time.Now().UTC()})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUpdateUserUnverifiesChangedEmail(t *testing.T) {
+	user := createTestUser(t)
+	verificationToken := createTestEmailVerificationToken(t, user, time.Now().Add(time.Hour))
+	verified, err := testQueries.VerifyEmail(context.Background(), VerifyEmailParams{TokenHash: verificationToken.TokenHash, VerifiedAt: time.Now().UTC()})
+	require.NoError(t, err)
+
+	// patching other fields keeps the address verified
+	patched, err := testQueries.PatchUser(context.Background(), PatchUserParams{
+		ID:        user.ID,
+		Version:   verified.Version,
+		FirstName: sql.NullString{String: util.RandomWord(5), Valid: true},
+	})
+	require.NoError(t, err)
+	require.True(t, patched.EmailVerifiedAt.Valid)
+
+	updated, err := testQueries.UpdateUser(context.Background(), UpdateUserParams{
+		ID:        user.ID,
+		Version:   patched.Version,
+		FirstName: patched.FirstName,
+		LastName:  patched.LastName,
+		Nickname:  patched.Nickname,
+		Password:  patched.Password,
+		Email:     util.RandomEmail(),
+		Country:   patched.Country,
+	})
+	require.NoError(t, err)
+	require.False(t, updated.EmailVerifiedAt.Valid)
+}
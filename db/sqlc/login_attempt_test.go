@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRecordLoginFailure(t *testing.T) {
+	key := "user:" + util.RandomWordWithNumbers(16)
+	failedAt := time.Now().UTC().Truncate(time.Second)
+
+	for i := 1; i <= 3; i++ {
+		attempt, err := testQueries.RecordLoginFailure(context.Background(), RecordLoginFailureParams{
+			Key:         key,
+			FailedAt:    failedAt,
+			ResetBefore: failedAt.Add(-time.Hour),
+		})
+		require.NoError(t, err)
+		require.Equal(t, key, attempt.Key)
+		require.Equal(t, int32(i), attempt.Failures)
+		require.WithinDuration(t, failedAt, attempt.LastFailureAt, time.Second)
+		require.False(t, attempt.LockedUntil.Valid)
+	}
+
+	// failures older than the reset are forgotten
+	later := failedAt.Add(2 * time.Hour)
+	attempt, err := testQueries.RecordLoginFailure(context.Background(), RecordLoginFailureParams{
+		Key:         key,
+		FailedAt:    later,
+		ResetBefore: later.Add(-time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), attempt.Failures)
+}
+
+func TestLockLoginAttempt(t *testing.T) {
+	key := "ip:" + util.RandomWordWithNumbers(16)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	_, err := testQueries.RecordLoginFailure(context.Background(), RecordLoginFailureParams{
+		Key:         key,
+		FailedAt:    now,
+		ResetBefore: now.Add(-time.Hour),
+	})
+	require.NoError(t, err)
+
+	err = testQueries.LockLoginAttempt(context.Background(), LockLoginAttemptParams{LockedUntil: now.Add(time.Hour), Key: key})
+	require.NoError(t, err)
+
+	// an earlier lock does not shorten the current one
+	err = testQueries.LockLoginAttempt(context.Background(), LockLoginAttemptParams{LockedUntil: now.Add(time.Minute), Key: key})
+	require.NoError(t, err)
+
+	attempt, err := testQueries.GetLoginAttempt(context.Background(), key)
+	require.NoError(t, err)
+	require.True(t, attempt.LockedUntil.Valid)
+	require.WithinDuration(t, now.Add(time.Hour), attempt.LockedUntil.Time, time.Second)
+
+	err = testQueries.DeleteLoginAttempt(context.Background(), key)
+	require.NoError(t, err)
+
+	_, err = testQueries.GetLoginAttempt(context.Background(), key)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestDeleteStaleLoginAttempts(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	staleKey := "login:" + util.RandomWordWithNumbers(16)
+	lockedKey := "login:" + util.RandomWordWithNumbers(16)
+	recentKey := "login:" + util.RandomWordWithNumbers(16)
+
+	for _, key := range []string{staleKey, lockedKey} {
+		_, err := testQueries.RecordLoginFailure(context.Background(), RecordLoginFailureParams{
+			Key:         key,
+			FailedAt:    now.Add(-2 * time.Hour),
+			ResetBefore: now.Add(-3 * time.Hour),
+		})
+		require.NoError(t, err)
+	}
+	err := testQueries.LockLoginAttempt(context.Background(), LockLoginAttemptParams{LockedUntil: now.Add(time.Hour), Key: lockedKey})
+	require.NoError(t, err)
+
+	_, err = testQueries.RecordLoginFailure(context.Background(), RecordLoginFailureParams{
+		Key:         recentKey,
+		FailedAt:    now,
+		ResetBefore: now.Add(-time.Hour),
+	})
+	require.NoError(t, err)
+
+	rows, err := testQueries.DeleteStaleLoginAttempts(context.Background(), DeleteStaleLoginAttemptsParams{
+		FailedBefore: now.Add(-time.Hour),
+		Now:          now,
+	})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, rows, int64(1))
+
+	_, err = testQueries.GetLoginAttempt(context.Background(), staleKey)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// locked and recently failed keys are kept
+	for _, key := range []string{lockedKey, recentKey} {
+		_, err = testQueries.GetLoginAttempt(context.Background(), key)
+		require.NoError(t, err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 var testDB *sql.DB
 var testQueries *Queries
+var testStore *SQLStore
 
 func TestMain(m *testing.M) {
 	var err error
@@ -25,6 +26,7 @@ func TestMain(m *testing.M) {
 	}
 
 	testQueries = New(testDB)
+	testStore = NewStore(testDB)
 
 	os.Exit(m.Run())
 }
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func createTestUserMFA(t *testing.T, user *User) *UserMfa {
+	params := CreateUserMFAParams{
+		UserID: user.ID,
+		Secret: util.RandomWordWithNumbers(32),
+	}
+
+	mfa, err := testQueries.CreateUserMFA(context.Background(), params)
+	require.NoError(t, err)
+
+	require.Equal(t, params.UserID, mfa.UserID)
+	require.Equal(t, params.Secret, mfa.Secret)
+	require.False(t, mfa.ConfirmedAt.Valid)
+	require.Zero(t, mfa.LastUsedCounter)
+
+	return &mfa
+}
+
+func TestCreateUserMFA(t *testing.T) {
+	user := createTestUser(t)
+	createTestUserMFA(t, user)
+
+	// enrolling again replaces the pending secret
+	second := createTestUserMFA(t, user)
+
+	mfa, err := testQueries.GetUserMFA(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, second.Secret, mfa.Secret)
+}
+
+func TestConfirmUserMFA(t *testing.T) {
+	user := createTestUser(t)
+	createTestUserMFA(t, user)
+
+	mfa, err := testQueries.ConfirmUserMFA(context.Background(), ConfirmUserMFAParams{UserID: user.ID, LastUsedCounter: 100})
+	require.NoError(t, err)
+	require.True(t, mfa.ConfirmedAt.Valid)
+	require.Equal(t, int64(100), mfa.LastUsedCounter)
+
+	_, err = testQueries.ConfirmUserMFA(context.Background(), ConfirmUserMFAParams{UserID: user.ID, LastUsedCounter: 101})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// confirmed secret can not be replaced by enrolling again
+	_, err = testQueries.CreateUserMFA(context.Background(), CreateUserMFAParams{UserID: user.ID, Secret: util.RandomWord(32)})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUseMFACode(t *testing.T) {
+	user := createTestUser(t)
+	createTestUserMFA(t, user)
+
+	// codes can not be used before the enrollment is confirmed
+	rows, err := testQueries.UseMFACode(context.Background(), UseMFACodeParams{UserID: user.ID, LastUsedCounter: 100})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+
+	_, err = testQueries.ConfirmUserMFA(context.Background(), ConfirmUserMFAParams{UserID: user.ID, LastUsedCounter: 100})
+	require.NoError(t, err)
+
+	rows, err = testQueries.UseMFACode(context.Background(), UseMFACodeParams{UserID: user.ID, LastUsedCounter: 101})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rows)
+
+	// codes of the same or earlier time step can not be used again
+	rows, err = testQueries.UseMFACode(context.Background(), UseMFACodeParams{UserID: user.ID, LastUsedCounter: 101})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+}
+
+func TestDeleteUserMFA(t *testing.T) {
+	user := createTestUser(t)
+	createTestUserMFA(t, user)
+
+	err := testQueries.DeleteUserMFA(context.Background(), user.ID)
+	require.NoError(t, err)
+
+	_, err = testQueries.GetUserMFA(context.Background(), user.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestMFARecoveryCodes(t *testing.T) {
+	user := createTestUser(t)
+	hashes := []string{util.RandomWordWithNumbers(64), util.RandomWordWithNumbers(64), util.RandomWordWithNumbers(64)}
+
+	err := testQueries.CreateMFARecoveryCodes(context.Background(), CreateMFARecoveryCodesParams{UserID: user.ID, CodeHashes: hashes})
+	require.NoError(t, err)
+
+	count, err := testQueries.CountMFARecoveryCodes(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+
+	rows, err := testQueries.UseMFARecoveryCode(context.Background(), UseMFARecoveryCodeParams{UserID: user.ID, CodeHash: hashes[0]})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rows)
+
+	// recovery codes can be used only once
+	rows, err = testQueries.UseMFARecoveryCode(context.Background(), UseMFARecoveryCodeParams{UserID: user.ID, CodeHash: hashes[0]})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+
+	count, err = testQueries.CountMFARecoveryCodes(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	err = testQueries.DeleteMFARecoveryCodes(context.Background(), user.ID)
+	require.NoError(t, err)
+
+	count, err = testQueries.CountMFARecoveryCodes(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func TestConfirmMFATx(t *testing.T) {
+	user := createTestUser(t)
+	createTestUserMFA(t, user)
+	hashes := []string{util.RandomWordWithNumbers(64), util.RandomWordWithNumbers(64)}
+
+	mfa, err := testStore.ConfirmMFATx(context.Background(), ConfirmMFATxParams{UserID: user.ID, LastUsedCounter: 100, CodeHashes: hashes})
+	require.NoError(t, err)
+	require.True(t, mfa.ConfirmedAt.Valid)
+
+	count, err := testQueries.CountMFARecoveryCodes(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	// recovery codes are kept when MFA is already confirmed
+	_, err = testStore.ConfirmMFATx(context.Background(), ConfirmMFATxParams{
+		UserID:          user.ID,
+		LastUsedCounter: 101,
+		CodeHashes:      []string{util.RandomWordWithNumbers(64)},
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	rows, err := testQueries.UseMFARecoveryCode(context.Background(), UseMFARecoveryCodeParams{UserID: user.ID, CodeHash: hashes[0]})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rows)
+}
+
+func TestReplaceMFARecoveryCodesTx(t *testing.T) {
+	user := createTestUser(t)
+	oldHash := util.RandomWordWithNumbers(64)
+
+	err := testQueries.CreateMFARecoveryCodes(context.Background(), CreateMFARecoveryCodesParams{UserID: user.ID, CodeHashes: []string{oldHash}})
+	require.NoError(t, err)
+
+	newHashes := []string{util.RandomWordWithNumbers(64), util.RandomWordWithNumbers(64), util.RandomWordWithNumbers(64)}
+	err = testStore.ReplaceMFARecoveryCodesTx(context.Background(), CreateMFARecoveryCodesParams{UserID: user.ID, CodeHashes: newHashes})
+	require.NoError(t, err)
+
+	count, err := testQueries.CountMFARecoveryCodes(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+
+	rows, err := testQueries.UseMFARecoveryCode(context.Background(), UseMFARecoveryCodeParams{UserID: user.ID, CodeHash: oldHash})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+}
+
+func TestDisableMFATx(t *testing.T) {
+	user := createTestUser(t)
+	createTestUserMFA(t, user)
+	session := createTestSession(t, user)
+
+	err := testQueries.CreateMFARecoveryCodes(context.Background(), CreateMFARecoveryCodesParams{
+		UserID:     user.ID,
+		CodeHashes: []string{util.RandomWordWithNumbers(64)},
+	})
+	require.NoError(t, err)
+
+	// pending enrollment is cancelled without logging the user out
+	err = testStore.DisableMFATx(context.Background(), DisableMFATxParams{UserID: user.ID})
+	require.NoError(t, err)
+
+	_, err = testQueries.GetUserMFA(context.Background(), user.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	count, err := testQueries.CountMFARecoveryCodes(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	result, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.False(t, result.Revoked)
+
+	createTestUserMFA(t, user)
+	err = testStore.DisableMFATx(context.Background(), DisableMFATxParams{UserID: user.ID, RevokeSessions: true})
+	require.NoError(t, err)
+
+	result, err = testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.True(t, result.Revoked)
+}
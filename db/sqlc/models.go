@@ -5,19 +5,87 @@
 package db
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type EmailVerificationToken struct {
+	TokenHash string       `json:"token_hash"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Email     string       `json:"email"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	Key           string       `json:"key"`
+	Failures      int32        `json:"failures"`
+	LastFailureAt time.Time    `json:"last_failure_at"`
+	LockedUntil   sql.NullTime `json:"locked_until"`
+}
+
+type MfaRecoveryCode struct {
+	CodeHash  string       `json:"code_hash"`
+	UserID    uuid.UUID    `json:"user_id"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	TokenHash string       `json:"token_hash"`
+	UserID    uuid.UUID    `json:"user_id"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Session struct {
+	ID               uuid.UUID `json:"id"`
+	UserID           uuid.UUID `json:"user_id"`
+	RefreshTokenHash string    `json:"refresh_token_hash"`
+	UserAgent        string    `json:"user_agent"`
+	ClientIp         string    `json:"client_ip"`
+	Revoked          bool      `json:"revoked"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	CreatedAt        time.Time `json:"created_at"`
+	MfaAuthenticated bool      `json:"mfa_authenticated"`
+}
+
 type User struct {
-	ID         uuid.UUID `json:"id"`
-	FirstName  string    `json:"first_name"`
-	LastName   string    `json:"last_name"`
-	Nickname   string    `json:"nickname"`
-	Password   string    `json:"password"`
-	Email      string    `json:"email"`
-	Country    string    `json:"country"`
-	ModifiedAt time.Time `json:"modified_at"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID              uuid.UUID    `json:"id"`
+	FirstName       string       `json:"first_name"`
+	LastName        string       `json:"last_name"`
+	Nickname        string       `json:"nickname"`
+	Password        string       `json:"password"`
+	Email           string       `json:"email"`
+	Country         string       `json:"country"`
+	ModifiedAt      time.Time    `json:"modified_at"`
+	CreatedAt       time.Time    `json:"created_at"`
+	DeletedAt       sql.NullTime `json:"deleted_at"`
+	Version         int64        `json:"version"`
+	SearchVector    interface{}  `json:"search_vector"`
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
+}
+
+type UserMfa struct {
+	UserID          uuid.UUID    `json:"user_id"`
+	Secret          string       `json:"secret"`
+	ConfirmedAt     sql.NullTime `json:"confirmed_at"`
+	LastUsedCounter int64        `json:"last_used_counter"`
+	CreatedAt       time.Time    `json:"created_at"`
+}
+
+type UserRole struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
 }
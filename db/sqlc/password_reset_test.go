@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func createTestPasswordResetToken(t *testing.T, user *User, expiresAt time.Time) *PasswordResetToken {
+	params := CreatePasswordResetTokenParams{
+		TokenHash: util.RandomWordWithNumbers(64),
+		UserID:    user.ID,
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}
+
+	resetToken, err := testQueries.CreatePasswordResetToken(context.Background(), params)
+	require.NoError(t, err)
+
+	require.Equal(t, params.TokenHash, resetToken.TokenHash)
+	require.Equal(t, params.UserID, resetToken.UserID)
+	require.WithinDuration(t, params.ExpiresAt, resetToken.ExpiresAt, time.Second)
+	require.False(t, resetToken.UsedAt.Valid)
+
+	return &resetToken
+}
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	createTestPasswordResetToken(t, createTestUser(t), time.Now().Add(time.Hour))
+}
+
+func TestResetPassword(t *testing.T) {
+	user := createTestUser(t)
+	resetToken := createTestPasswordResetToken(t, user, time.Now().Add(time.Hour))
+	params := ResetPasswordParams{TokenHash: resetToken.TokenHash, Password: util.RandomWord(10), ResetAt: time.Now().UTC()}
+
+	result, err := testQueries.ResetPassword(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, result.ID)
+	require.Equal(t, params.Password, result.Password)
+
+	// tokens can be used only once
+	_, err = testQueries.ResetPassword(context.Background(), params)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestResetPasswordExpired(t *testing.T) {
+	user := createTestUser(t)
+	resetToken := createTestPasswordResetToken(t, user, time.Now().Add(-time.Minute))
+
+	_, err := testQueries.ResetPassword(context.Background(), ResetPasswordParams{
+		TokenHash: resetToken.TokenHash,
+		Password:  util.RandomWord(10),
+		ResetAt:   time.Now().UTC(),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestResetPasswordExpiresAtGivenTime(t *testing.T) {
+	user := createTestUser(t)
+	resetToken := createTestPasswordResetToken(t, user, time.Now().Add(time.Hour))
+
+	// expiry is compared with the time passed in rather than the clock of the database session
+	_, err := testQueries.ResetPassword(context.Background(), ResetPasswordParams{
+		TokenHash: resetToken.TokenHash,
+		Password:  util.RandomWord(10),
+		ResetAt:   time.Now().Add(2 * time.Hour).UTC(),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestInvalidatePasswordResetTokens(t *testing.T) {
+	user := createTestUser(t)
+	resetToken := createTestPasswordResetToken(t, user, time.Now().Add(time.Hour))
+	otherToken := createTestPasswordResetToken(t, createTestUser(t), time.Now().Add(time.Hour))
+
+	err := testQueries.InvalidatePasswordResetTokens(context.Background(), user.ID)
+	require.NoError(t, err)
+
+	_, err = testQueries.ResetPassword(context.Background(), ResetPasswordParams{
+		TokenHash: resetToken.TokenHash,
+		Password:  util.RandomWord(10),
+		ResetAt:   time.Now().UTC(),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = testQueries.ResetPassword(context.Background(), ResetPasswordParams{
+		TokenHash: otherToken.TokenHash,
+		Password:  util.RandomWord(10),
+		ResetAt:   time.Now().UTC(),
+	})
+	require.NoError(t, err)
+}
+
+func TestResetPasswordTx(t *testing.T) {
+	user := createTestUser(t)
+	resetToken := createTestPasswordResetToken(t, user, time.Now().Add(time.Hour))
+	otherToken := createTestPasswordResetToken(t, user, time.Now().Add(time.Hour))
+	session := createTestSession(t, user)
+	params := ResetPasswordParams{TokenHash: resetToken.TokenHash, Password: util.RandomWord(10), ResetAt: time.Now().UTC()}
+
+	result, err := testStore.ResetPasswordTx(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, result.ID)
+	require.Equal(t, params.Password, result.Password)
+
+	_, err = testQueries.ResetPassword(context.Background(), ResetPasswordParams{
+		TokenHash: otherToken.TokenHash,
+		Password:  util.RandomWord(10),
+		ResetAt:   time.Now().UTC(),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	revoked, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.True(t, revoked.Revoked)
+
+	// nothing changes when the token is not valid
+	otherSession := createTestSession(t, user)
+	_, err = testStore.ResetPasswordTx(context.Background(), params)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	active, err := testQueries.GetSession(context.Background(), otherSession.ID)
+	require.NoError(t, err)
+	require.False(t, active.Revoked)
+}
@@ -6,16 +6,51 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Querier interface {
+	AddUserRole(ctx context.Context, arg AddUserRoleParams) error
+	ConfirmUserMFA(ctx context.Context, arg ConfirmUserMFAParams) (UserMfa, error)
+	CountMFARecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error)
+	CountUsersBreakingGmailRules(ctx context.Context) (int64, error)
+	CreateEmailVerificationToken(ctx context.Context, arg CreateEmailVerificationTokenParams) (EmailVerificationToken, error)
+	CreateMFARecoveryCodes(ctx context.Context, arg CreateMFARecoveryCodesParams) error
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
-	DeleteUser(ctx context.Context, id uuid.UUID) error
+	CreateUserMFA(ctx context.Context, arg CreateUserMFAParams) (UserMfa, error)
+	DeleteLoginAttempt(ctx context.Context, key string) error
+	DeleteMFARecoveryCodes(ctx context.Context, userID uuid.UUID) error
+	DeleteStaleLoginAttempts(ctx context.Context, arg DeleteStaleLoginAttemptsParams) (int64, error)
+	DeleteUser(ctx context.Context, arg DeleteUserParams) (int64, error)
+	DeleteUserMFA(ctx context.Context, userID uuid.UUID) error
+	GetLoginAttempt(ctx context.Context, key string) (LoginAttempt, error)
+	GetSession(ctx context.Context, id uuid.UUID) (Session, error)
 	GetUser(ctx context.Context, id uuid.UUID) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByLogin(ctx context.Context, arg GetUserByLoginParams) (User, error)
+	GetUserMFA(ctx context.Context, userID uuid.UUID) (UserMfa, error)
+	InvalidatePasswordResetTokens(ctx context.Context, userID uuid.UUID) error
+	ListUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error)
 	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	LockLoginAttempt(ctx context.Context, arg LockLoginAttemptParams) error
+	PatchUser(ctx context.Context, arg PatchUserParams) (User, error)
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginAttempt, error)
+	RemoveUserRole(ctx context.Context, arg RemoveUserRoleParams) error
+	ResetPassword(ctx context.Context, arg ResetPasswordParams) (User, error)
+	RestoreUser(ctx context.Context, id uuid.UUID) (User, error)
+	RevokeSession(ctx context.Context, id uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+	SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UseMFACode(ctx context.Context, arg UseMFACodeParams) (int64, error)
+	UseMFARecoveryCode(ctx context.Context, arg UseMFARecoveryCodeParams) (int64, error)
+	VerifyEmail(ctx context.Context, arg VerifyEmailParams) (User, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUserRoles(t *testing.T) {
+	testUser := createTestUser(t)
+
+	roles, err := testQueries.ListUserRoles(context.Background(), testUser.ID)
+	require.NoError(t, err)
+	require.Empty(t, roles)
+
+	params := AddUserRoleParams{
+		UserID: testUser.ID,
+		Role:   util.RoleAdmin,
+	}
+
+	err = testQueries.AddUserRole(context.Background(), params)
+	require.NoError(t, err)
+
+	// granting the same role twice is a no-op
+	err = testQueries.AddUserRole(context.Background(), params)
+	require.NoError(t, err)
+
+	roles, err = testQueries.ListUserRoles(context.Background(), testUser.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{util.RoleAdmin}, roles)
+
+	err = testQueries.RemoveUserRole(context.Background(), RemoveUserRoleParams{
+		UserID: testUser.ID,
+		Role:   util.RoleAdmin,
+	})
+	require.NoError(t, err)
+
+	roles, err = testQueries.ListUserRoles(context.Background(), testUser.ID)
+	require.NoError(t, err)
+	require.Empty(t, roles)
+}
+
+func TestAddUnknownUserRole(t *testing.T) {
+	testUser := createTestUser(t)
+
+	err := testQueries.AddUserRole(context.Background(), AddUserRoleParams{
+		UserID: testUser.ID,
+		Role:   util.RandomWord(10),
+	})
+	require.Error(t, err)
+}
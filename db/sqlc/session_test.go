@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func createTestSession(t *testing.T, user *User) *Session {
+	params := CreateSessionParams{
+		ID:               uuid.New(),
+		UserID:           user.ID,
+		RefreshTokenHash: util.RandomWordWithNumbers(64),
+		UserAgent:        util.RandomWord(10),
+		ClientIp:         "127.0.0.1",
+		ExpiresAt:        time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+
+	session, err := testQueries.CreateSession(context.Background(), params)
+	require.NoError(t, err)
+	require.NotEmpty(t, session)
+
+	require.Equal(t, params.ID, session.ID)
+	require.Equal(t, params.UserID, session.UserID)
+	require.Equal(t, params.RefreshTokenHash, session.RefreshTokenHash)
+	require.Equal(t, params.UserAgent, session.UserAgent)
+	require.Equal(t, params.ClientIp, session.ClientIp)
+	require.WithinDuration(t, params.ExpiresAt, session.ExpiresAt, time.Second)
+	require.False(t, session.Revoked)
+
+	return &session
+}
+
+func TestCreateSession(t *testing.T) {
+	createTestSession(t, createTestUser(t))
+}
+
+func TestRevokeSession(t *testing.T) {
+	session := createTestSession(t, createTestUser(t))
+
+	err := testQueries.RevokeSession(context.Background(), session.ID)
+	require.NoError(t, err)
+
+	result, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.True(t, result.Revoked)
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	user := createTestUser(t)
+	otherSession := createTestSession(t, createTestUser(t))
+
+	n := 3
+	sessions := make([]*Session, n)
+	for i := 0; i < n; i++ {
+		sessions[i] = createTestSession(t, user)
+	}
+
+	err := testQueries.RevokeUserSessions(context.Background(), user.ID)
+	require.NoError(t, err)
+
+	for _, v := range sessions {
+		result, err := testQueries.GetSession(context.Background(), v.ID)
+		require.NoError(t, err)
+		require.True(t, result.Revoked)
+	}
+
+	result, err := testQueries.GetSession(context.Background(), otherSession.ID)
+	require.NoError(t, err)
+	require.False(t, result.Revoked)
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// Store provides the queries generated by sqlc together with the queries which are built at runtime
+// and the ones which have to run in a single transaction
+type Store interface {
+	Querier
+	CountUsersFiltered(ctx context.Context, arg ListUsersFilteredParams) (int64, error)
+	EstimateUsers(ctx context.Context, includeDeleted bool) (int64, error)
+	ListUsersFiltered(ctx context.Context, arg ListUsersFilteredParams) ([]User, error)
+	ResetPasswordTx(ctx context.Context, arg ResetPasswordParams) (User, error)
+	ConfirmMFATx(ctx context.Context, arg ConfirmMFATxParams) (UserMfa, error)
+	ReplaceMFARecoveryCodesTx(ctx context.Context, arg CreateMFARecoveryCodesParams) error
+	DisableMFATx(ctx context.Context, arg DisableMFATxParams) error
+}
+
+// SQLStore implements Store on top of a database connection which transactions can be started on
+type SQLStore struct {
+	*Queries
+	db *sql.DB
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// NewStore creates a new SQLStore
+func NewStore(db *sql.DB) *SQLStore {
+	return &SQLStore{
+		Queries: New(db),
+		db:      db,
+	}
+}
+
+// execTx runs fn with queries bound to a new transaction, which is committed if fn succeeds and rolled back otherwise
+func (s *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(New(tx))
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx err: %v, rollback err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPasswordTx sets the new password with a reset token, invalidates other reset tokens of the user
+// and revokes their sessions, either all of it happens or nothing does
+func (s *SQLStore) ResetPasswordTx(ctx context.Context, arg ResetPasswordParams) (User, error) {
+	var user User
+
+	err := s.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		user, err = q.ResetPassword(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		err = q.InvalidatePasswordResetTokens(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		return q.RevokeUserSessions(ctx, user.ID)
+	})
+
+	return user, err
+}
+
+// replaceMFARecoveryCodes deletes recovery codes of the user and creates the new ones
+func replaceMFARecoveryCodes(ctx context.Context, q *Queries, arg CreateMFARecoveryCodesParams) error {
+	err := q.DeleteMFARecoveryCodes(ctx, arg.UserID)
+	if err != nil {
+		return err
+	}
+
+	return q.CreateMFARecoveryCodes(ctx, arg)
+}
+
+// ConfirmMFATxParams contains the code counter MFA enrollment is confirmed with and hashes of the first recovery codes
+type ConfirmMFATxParams struct {
+	UserID          uuid.UUID `json:"user_id"`
+	LastUsedCounter int64     `json:"last_used_counter"`
+	CodeHashes      []string  `json:"code_hashes"`
+}
+
+// ConfirmMFATx confirms pending MFA enrollment of the user together with creating their recovery codes,
+// so that MFA is never enabled without them
+func (s *SQLStore) ConfirmMFATx(ctx context.Context, arg ConfirmMFATxParams) (UserMfa, error) {
+	var mfa UserMfa
+
+	err := s.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		mfa, err = q.ConfirmUserMFA(ctx, ConfirmUserMFAParams{
+			UserID:          arg.UserID,
+			LastUsedCounter: arg.LastUsedCounter,
+		})
+		if err != nil {
+			return err
+		}
+
+		return replaceMFARecoveryCodes(ctx, q, CreateMFARecoveryCodesParams{
+			UserID:     arg.UserID,
+			CodeHashes: arg.CodeHashes,
+		})
+	})
+
+	return mfa, err
+}
+
+// ReplaceMFARecoveryCodesTx replaces recovery codes of the user, the old codes keep working if the new ones
+// can not be created
+func (s *SQLStore) ReplaceMFARecoveryCodesTx(ctx context.Context, arg CreateMFARecoveryCodesParams) error {
+	return s.execTx(ctx, func(q *Queries) error {
+		return replaceMFARecoveryCodes(ctx, q, arg)
+	})
+}
+
+// DisableMFATxParams contains the user whose MFA is disabled and whether their sessions are revoked too
+type DisableMFATxParams struct {
+	UserID         uuid.UUID `json:"user_id"`
+	RevokeSessions bool      `json:"revoke_sessions"`
+}
+
+// DisableMFATx deletes MFA of the user together with their recovery codes and, when asked to, their sessions,
+// so that none of them outlives the others
+func (s *SQLStore) DisableMFATx(ctx context.Context, arg DisableMFATxParams) error {
+	return s.execTx(ctx, func(q *Queries) error {
+		err := q.DeleteUserMFA(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = q.DeleteMFARecoveryCodes(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		if !arg.RevokeSessions {
+			return nil
+		}
+
+		return q.RevokeUserSessions(ctx, arg.UserID)
+	})
+}
@@ -7,10 +7,25 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countUsersBreakingGmailRules = `-- name: CountUsersBreakingGmailRules :one
+SELECT count(*) FROM users
+WHERE lower(substring(email from '@([^@]*)$')) IN ('gmail.com', 'googlemail.com')
+  AND email <> replace(lower(split_part(substring(email from '^(.*)@'), '+', 1)), '.', '') || '@gmail.com'
+`
+
+func (q *Queries) CountUsersBreakingGmailRules(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersBreakingGmailRules)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
                    first_name,
@@ -20,7 +35,7 @@ INSERT INTO users (
                    email,
                    country
 )
-VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, first_name, last_name, nickname, password, email, country, modified_at, created_at
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -52,23 +67,37 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Country,
 		&i.ModifiedAt,
 		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.SearchVector,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
-const deleteUser = `-- name: DeleteUser :exec
-DELETE FROM users
-WHERE id = $1
+const deleteUser = `-- name: DeleteUser :execrows
+UPDATE users
+SET deleted_at = now()
+WHERE id = $1 AND deleted_at IS NULL AND version = $2
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteUser, id)
-	return err
+type DeleteUserParams struct {
+	ID      uuid.UUID `json:"id"`
+	Version int64     `json:"version"`
+}
+
+func (q *Queries) DeleteUser(ctx context.Context, arg DeleteUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, arg.ID, arg.Version)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, first_name, last_name, nickname, password, email, country, modified_at, created_at FROM users
-WHERE id = $1 LIMIT 1
+SELECT id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at FROM users
+WHERE id = $1 AND deleted_at IS NULL
+LIMIT 1
 `
 
 func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
@@ -84,12 +113,77 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Country,
 		&i.ModifiedAt,
 		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.SearchVector,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at FROM users
+WHERE lower(email) = lower($1) AND deleted_at IS NULL
+LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Nickname,
+		&i.Password,
+		&i.Email,
+		&i.Country,
+		&i.ModifiedAt,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.SearchVector,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByLogin = `-- name: GetUserByLogin :one
+SELECT id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at FROM users
+WHERE (nickname = $1 OR lower(email) = lower($2)) AND deleted_at IS NULL
+ORDER BY nickname = $1 DESC
+LIMIT 1
+`
+
+type GetUserByLoginParams struct {
+	Nickname string `json:"nickname"`
+	Email    string `json:"email"`
+}
+
+func (q *Queries) GetUserByLogin(ctx context.Context, arg GetUserByLoginParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByLogin, arg.Nickname, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Nickname,
+		&i.Password,
+		&i.Email,
+		&i.Country,
+		&i.ModifiedAt,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.SearchVector,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT id, first_name, last_name, nickname, password, email, country, modified_at, created_at FROM users
+SELECT id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at FROM users
+WHERE deleted_at IS NULL
 ORDER BY id
 LIMIT $1
 OFFSET $2
@@ -119,6 +213,208 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 			&i.Country,
 			&i.ModifiedAt,
 			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.Version,
+			&i.SearchVector,
+			&i.EmailVerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const patchUser = `-- name: PatchUser :one
+UPDATE users
+SET first_name = COALESCE($1, first_name),
+    last_name = COALESCE($2, last_name),
+    nickname = COALESCE($3, nickname),
+    password = COALESCE($4, password),
+    email = COALESCE($5, email),
+    country = COALESCE($6, country),
+    email_verified_at = CASE WHEN COALESCE($5, email) = email THEN email_verified_at END
+WHERE id = $7 AND deleted_at IS NULL AND version = $8
+RETURNING id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at
+`
+
+type PatchUserParams struct {
+	FirstName sql.NullString `json:"first_name"`
+	LastName  sql.NullString `json:"last_name"`
+	Nickname  sql.NullString `json:"nickname"`
+	Password  sql.NullString `json:"password"`
+	Email     sql.NullString `json:"email"`
+	Country   sql.NullString `json:"country"`
+	ID        uuid.UUID      `json:"id"`
+	Version   int64          `json:"version"`
+}
+
+func (q *Queries) PatchUser(ctx context.Context, arg PatchUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, patchUser,
+		arg.FirstName,
+		arg.LastName,
+		arg.Nickname,
+		arg.Password,
+		arg.Email,
+		arg.Country,
+		arg.ID,
+		arg.Version,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Nickname,
+		&i.Password,
+		&i.Email,
+		&i.Country,
+		&i.ModifiedAt,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.SearchVector,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at < $1::timestamp
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, restoreUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Nickname,
+		&i.Password,
+		&i.Email,
+		&i.Country,
+		&i.ModifiedAt,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.SearchVector,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+WITH search AS (
+    SELECT websearch_to_tsquery('simple', $1::text) AS query,
+           -- matches are marked with private use characters, so that the API can escape the values
+           'HighlightAll=true, StartSel=' || chr(57344) || ', StopSel=' || chr(57345) AS headline_options
+)
+SELECT users.id, users.first_name, users.last_name, users.nickname, users.email, users.country,
+       users.modified_at, users.created_at, users.deleted_at, users.version,
+       (ts_rank(users.search_vector, search.query) + greatest(
+           word_similarity($1::text, users.first_name),
+           word_similarity($1::text, users.last_name),
+           word_similarity($1::text, users.nickname),
+           word_similarity($1::text, users.email)
+       ))::real AS rank,
+       ts_headline('simple', users.first_name, search.query, search.headline_options)::text AS first_name_headline,
+       ts_headline('simple', users.last_name, search.query, search.headline_options)::text AS last_name_headline,
+       ts_headline('simple', users.nickname, search.query, search.headline_options)::text AS nickname_headline,
+       ts_headline('simple', users.email, search.query, search.headline_options)::text AS email_headline,
+       ($1::text <% users.first_name)::bool AS first_name_similar,
+       ($1::text <% users.last_name)::bool AS last_name_similar,
+       ($1::text <% users.nickname)::bool AS nickname_similar,
+       ($1::text <% users.email)::bool AS email_similar
+FROM users, search
+WHERE users.deleted_at IS NULL
+  AND (users.search_vector @@ search.query
+    OR $1::text <% users.first_name
+    OR $1::text <% users.last_name
+    OR $1::text <% users.nickname
+    OR $1::text <% users.email)
+ORDER BY rank DESC, users.id
+LIMIT $2::int
+`
+
+type SearchUsersParams struct {
+	Query    string `json:"query"`
+	RowLimit int32  `json:"row_limit"`
+}
+
+type SearchUsersRow struct {
+	ID                uuid.UUID    `json:"id"`
+	FirstName         string       `json:"first_name"`
+	LastName          string       `json:"last_name"`
+	Nickname          string       `json:"nickname"`
+	Email             string       `json:"email"`
+	Country           string       `json:"country"`
+	ModifiedAt        time.Time    `json:"modified_at"`
+	CreatedAt         time.Time    `json:"created_at"`
+	DeletedAt         sql.NullTime `json:"deleted_at"`
+	Version           int64        `json:"version"`
+	Rank              float32      `json:"rank"`
+	FirstNameHeadline string       `json:"first_name_headline"`
+	LastNameHeadline  string       `json:"last_name_headline"`
+	NicknameHeadline  string       `json:"nickname_headline"`
+	EmailHeadline     string       `json:"email_headline"`
+	FirstNameSimilar  bool         `json:"first_name_similar"`
+	LastNameSimilar   bool         `json:"last_name_similar"`
+	NicknameSimilar   bool         `json:"nickname_similar"`
+	EmailSimilar      bool         `json:"email_similar"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Query, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchUsersRow{}
+	for rows.Next() {
+		var i SearchUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Nickname,
+			&i.Email,
+			&i.Country,
+			&i.ModifiedAt,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.Version,
+			&i.Rank,
+			&i.FirstNameHeadline,
+			&i.LastNameHeadline,
+			&i.NicknameHeadline,
+			&i.EmailHeadline,
+			&i.FirstNameSimilar,
+			&i.LastNameSimilar,
+			&i.NicknameSimilar,
+			&i.EmailSimilar,
 		); err != nil {
 			return nil, err
 		}
@@ -140,9 +436,10 @@ SET first_name = $2,
     nickname = $4,
     password = $5,
     email = $6,
-    country = $7
-WHERE id = $1
-RETURNING id, first_name, last_name, nickname, password, email, country, modified_at, created_at
+    country = $7,
+    email_verified_at = CASE WHEN email = $6 THEN email_verified_at END
+WHERE id = $1 AND deleted_at IS NULL AND version = $8
+RETURNING id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at
 `
 
 type UpdateUserParams struct {
@@ -153,6 +450,7 @@ type UpdateUserParams struct {
 	Password  string    `json:"password"`
 	Email     string    `json:"email"`
 	Country   string    `json:"country"`
+	Version   int64     `json:"version"`
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
@@ -164,6 +462,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		arg.Password,
 		arg.Email,
 		arg.Country,
+		arg.Version,
 	)
 	var i User
 	err := row.Scan(
@@ -176,6 +475,26 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Country,
 		&i.ModifiedAt,
 		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.SearchVector,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password = $2
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type UpdateUserPasswordParams struct {
+	ID       uuid.UUID `json:"id"`
+	Password string    `json:"password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.Password)
+	return err
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// userColumns lists columns of the users table in the order they are scanned into User
+const userColumns = "id, first_name, last_name, nickname, password, email, country, modified_at, created_at, deleted_at, version, search_vector, email_verified_at"
+
+// userSortColumns whitelists the fields users can be sorted by, keys are the names exposed to clients
+// and values the columns they are sorted by, no other input ever gets into ORDER BY
+var userSortColumns = map[string]string{
+	"created_at":  "created_at",
+	"modified_at": "modified_at",
+	"first_name":  "first_name",
+	"last_name":   "last_name",
+	"nickname":    "nickname",
+	"email":       "email",
+	"country":     "country",
+}
+
+// ErrInvalidUserSort is returned when users are sorted by a field which is not whitelisted
+var ErrInvalidUserSort = errors.New("invalid user sort field")
+
+// ErrSortedUserCursor is returned when users are listed after a cursor and sorted at the same time,
+// cursors only point into the (created_at, id) order
+var ErrSortedUserCursor = errors.New("users listed after a cursor can not be sorted")
+
+// IsUserSortField reports whether users can be sorted by the field
+func IsUserSortField(field string) bool {
+	_, ok := userSortColumns[field]
+	return ok
+}
+
+// UserSort is a single field of ORDER BY clause
+type UserSort struct {
+	Field      string
+	Descending bool
+}
+
+// ListUsersFilteredParams holds optional filters of ListUsersFiltered, zero values are not applied.
+// Time ranges include their From and exclude their To bound. AfterCreatedAt and AfterID make it list
+// users after the cursor in (created_at, id) order.
+type ListUsersFilteredParams struct {
+	Country        string
+	EmailDomain    string
+	NicknamePrefix string
+	CreatedFrom    time.Time
+	CreatedTo      time.Time
+	ModifiedFrom   time.Time
+	ModifiedTo     time.Time
+	IncludeDeleted bool
+	AfterCreatedAt time.Time
+	AfterID        uuid.UUID
+	Sort           []UserSort
+	Limit          int32
+	Offset         int32
+}
+
+// queryBuilder collects conditions and their arguments, every value is passed as a placeholder
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds the argument and returns its placeholder
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// where adds the condition, format gets placeholders of the values
+func (b *queryBuilder) where(format string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, value := range values {
+		placeholders[i] = b.arg(value)
+	}
+	b.conditions = append(b.conditions, fmt.Sprintf(format, placeholders...))
+}
+
+// whereClause joins the conditions into WHERE clause, it is empty when there are no conditions
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+
+	return "\nWHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// escapeLike escapes wildcards of LIKE pattern so that the value is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// whereUsers adds conditions of the filters, they are shared by the list and the count query
+func whereUsers(b *queryBuilder, arg ListUsersFilteredParams) {
+	if !arg.IncludeDeleted {
+		b.conditions = append(b.conditions, "deleted_at IS NULL")
+	}
+	if arg.Country != "" {
+		b.where("country = %s", arg.Country)
+	}
+	if arg.EmailDomain != "" {
+		b.where("lower(email) LIKE %s", "%@"+escapeLike(strings.ToLower(arg.EmailDomain)))
+	}
+	if arg.NicknamePrefix != "" {
+		b.where("nickname LIKE %s", escapeLike(arg.NicknamePrefix)+"%")
+	}
+	if !arg.CreatedFrom.IsZero() {
+		b.where("created_at >= %s", arg.CreatedFrom.UTC())
+	}
+	if !arg.CreatedTo.IsZero() {
+		b.where("created_at < %s", arg.CreatedTo.UTC())
+	}
+	if !arg.ModifiedFrom.IsZero() {
+		b.where("modified_at >= %s", arg.ModifiedFrom.UTC())
+	}
+	if !arg.ModifiedTo.IsZero() {
+		b.where("modified_at < %s", arg.ModifiedTo.UTC())
+	}
+}
+
+// buildListUsersQuery builds the query of ListUsersFiltered, users are always ordered by id last so that
+// pages are stable
+func buildListUsersQuery(arg ListUsersFilteredParams) (string, []interface{}, error) {
+	b := &queryBuilder{}
+	whereUsers(b, arg)
+
+	order := make([]string, 0, len(arg.Sort)+2)
+	if !arg.AfterCreatedAt.IsZero() || arg.AfterID != uuid.Nil {
+		if len(arg.Sort) > 0 {
+			return "", nil, ErrSortedUserCursor
+		}
+		b.where("(created_at, id) > (%s, %s)", arg.AfterCreatedAt.UTC(), arg.AfterID)
+	}
+	for _, sort := range arg.Sort {
+		column, ok := userSortColumns[sort.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidUserSort, sort.Field)
+		}
+		if sort.Descending {
+			column += " DESC"
+		}
+		order = append(order, column)
+	}
+	if len(order) == 0 {
+		order = append(order, "created_at")
+	}
+	order = append(order, "id")
+
+	query := "SELECT " + userColumns + " FROM users" + b.whereClause()
+	query += "\nORDER BY " + strings.Join(order, ", ")
+	if arg.Limit > 0 {
+		query += "\nLIMIT " + b.arg(arg.Limit)
+	}
+	if arg.Offset > 0 {
+		query += "\nOFFSET " + b.arg(arg.Offset)
+	}
+
+	return query, b.args, nil
+}
+
+// buildCountUsersQuery builds the query of CountUsersFiltered, the order, the cursor and the page are ignored
+func buildCountUsersQuery(arg ListUsersFilteredParams) (string, []interface{}) {
+	b := &queryBuilder{}
+	whereUsers(b, arg)
+
+	return "SELECT count(*) FROM users" + b.whereClause(), b.args
+}
+
+// CountUsersFiltered counts all users matching the filters of ListUsersFiltered
+func (q *Queries) CountUsersFiltered(ctx context.Context, arg ListUsersFilteredParams) (int64, error) {
+	query, args := buildCountUsersQuery(arg)
+	row := q.db.QueryRowContext(ctx, query, args...)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+// EstimateUsers returns the number of users from planner statistics, it is much cheaper than counting them but
+// only as fresh as the last ANALYZE. Statistics count soft-deleted rows too, so unless includeDeleted is set they
+// are subtracted, counting them is cheap thanks to the partial index on deleted_at. Zero is returned when the table
+// has never been analyzed. It is written by hand since sqlc can not resolve catalog tables.
+func (q *Queries) EstimateUsers(ctx context.Context, includeDeleted bool) (int64, error) {
+	query := "SELECT greatest(reltuples::bigint, 0) AS estimate FROM pg_class WHERE oid = 'users'::regclass"
+	if !includeDeleted {
+		query = "SELECT CASE WHEN reltuples > 0 " +
+			"THEN greatest(reltuples::bigint - (SELECT count(*) FROM users WHERE deleted_at IS NOT NULL), 0) " +
+			"ELSE 0 END AS estimate FROM pg_class WHERE oid = 'users'::regclass"
+	}
+
+	row := q.db.QueryRowContext(ctx, query)
+	var estimate int64
+	err := row.Scan(&estimate)
+	return estimate, err
+}
+
+// ListUsersFiltered lists users matching all the filters, unlike the generated queries it is built at runtime
+// because the set of filters and the order are chosen by the client
+func (q *Queries) ListUsersFiltered(ctx context.Context, arg ListUsersFilteredParams) ([]User, error) {
+	query, args, err := buildListUsersQuery(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Nickname,
+			&i.Password,
+			&i.Email,
+			&i.Country,
+			&i.ModifiedAt,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.Version,
+			&i.SearchVector,
+			&i.EmailVerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
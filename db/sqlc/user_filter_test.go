@@ -0,0 +1,104 @@
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBuildListUsersQuery(t *testing.T) {
+	from := time.Date(2022, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	id := uuid.New()
+
+	testCases := []struct {
+		name      string
+		params    ListUsersFilteredParams
+		wantQuery string
+		wantArgs  []interface{}
+		wantErr   error
+	}{
+		{
+			name:      "No Filters",
+			params:    ListUsersFilteredParams{},
+			wantQuery: "SELECT " + userColumns + " FROM users\nWHERE deleted_at IS NULL\nORDER BY created_at, id",
+		},
+		{
+			name:      "Include Deleted",
+			params:    ListUsersFilteredParams{IncludeDeleted: true, Limit: 10, Offset: 20},
+			wantQuery: "SELECT " + userColumns + " FROM users\nORDER BY created_at, id\nLIMIT $1\nOFFSET $2",
+			wantArgs:  []interface{}{int32(10), int32(20)},
+		},
+		{
+			name: "All Filters",
+			params: ListUsersFilteredParams{
+				Country:        "PL",
+				EmailDomain:    "Example.com",
+				NicknamePrefix: "jo_%",
+				CreatedFrom:    from,
+				CreatedTo:      from.Add(time.Hour),
+				ModifiedFrom:   from,
+				ModifiedTo:     from.Add(time.Hour),
+				Sort:           []UserSort{{Field: "created_at", Descending: true}, {Field: "last_name"}},
+				Limit:          5,
+			},
+			wantQuery: "SELECT " + userColumns + " FROM users\n" +
+				"WHERE deleted_at IS NULL AND country = $1 AND lower(email) LIKE $2 AND nickname LIKE $3 AND " +
+				"created_at >= $4 AND created_at < $5 AND modified_at >= $6 AND modified_at < $7\n" +
+				"ORDER BY created_at DESC, last_name, id\nLIMIT $8",
+			wantArgs: []interface{}{
+				"PL", "%@example.com", `jo\_\%%`,
+				from.UTC(), from.Add(time.Hour).UTC(), from.UTC(), from.Add(time.Hour).UTC(),
+				int32(5),
+			},
+		},
+		{
+			name:      "After Cursor",
+			params:    ListUsersFilteredParams{AfterCreatedAt: from, AfterID: id, Limit: 3},
+			wantQuery: "SELECT " + userColumns + " FROM users\nWHERE deleted_at IS NULL AND (created_at, id) > ($1, $2)\nORDER BY created_at, id\nLIMIT $3",
+			wantArgs:  []interface{}{from.UTC(), id, int32(3)},
+		},
+		{
+			name:    "Sorted After Cursor",
+			params:  ListUsersFilteredParams{AfterCreatedAt: from, AfterID: id, Sort: []UserSort{{Field: "nickname"}}},
+			wantErr: ErrSortedUserCursor,
+		},
+		{
+			name:    "Invalid Sort",
+			params:  ListUsersFilteredParams{Sort: []UserSort{{Field: "password"}}},
+			wantErr: ErrInvalidUserSort,
+		},
+		{
+			name:    "Injected Sort",
+			params:  ListUsersFilteredParams{Sort: []UserSort{{Field: "id; DROP TABLE users"}}},
+			wantErr: ErrInvalidUserSort,
+		},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			query, args, err := buildListUsersQuery(v.params)
+			if v.wantErr != nil {
+				require.ErrorIs(t, err, v.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, v.wantQuery, query)
+			require.Equal(t, v.wantArgs, args)
+		})
+	}
+}
+
+func TestBuildCountUsersQuery(t *testing.T) {
+	query, args := buildCountUsersQuery(ListUsersFilteredParams{
+		Country:        "PL",
+		IncludeDeleted: true,
+		AfterID:        uuid.New(),
+		Sort:           []UserSort{{Field: "nickname"}},
+		Limit:          10,
+		Offset:         20,
+	})
+	require.Equal(t, "SELECT count(*) FROM users\nWHERE country = $1", query)
+	require.Equal(t, []interface{}{"PL"}, args)
+}
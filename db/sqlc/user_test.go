@@ -3,11 +3,12 @@ package db
 import (
 	"context"
 	"database/sql"
+	"github.com/lib/pq"
 	"github.com/rafdekar/user-api/util"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
-
-	_ "github.com/lib/pq"
+	"time"
 )
 
 func createTestUser(t *testing.T) *User {
@@ -43,6 +44,7 @@ func TestUpdateUser(t *testing.T) {
 
 	params := UpdateUserParams{
 		ID:        testUser.ID,
+		Version:   testUser.Version,
 		FirstName: util.RandomWord(5),
 		LastName:  util.RandomWord(5),
 		Nickname:  util.RandomWord(5),
@@ -64,6 +66,157 @@ func TestUpdateUser(t *testing.T) {
 	require.Equal(t, params.Country, result.Country)
 }
 
+func TestPatchUser(t *testing.T) {
+	testUser := createTestUser(t)
+
+	params := PatchUserParams{
+		ID:        testUser.ID,
+		Version:   testUser.Version,
+		FirstName: sql.NullString{String: util.RandomWord(5), Valid: true},
+		Country:   sql.NullString{String: util.RandomCountry(), Valid: true},
+	}
+
+	result, err := testQueries.PatchUser(context.Background(), params)
+	require.NoError(t, err)
+	require.NotEmpty(t, result)
+
+	require.Equal(t, testUser.ID, result.ID)
+	require.Equal(t, params.FirstName.String, result.FirstName)
+	require.Equal(t, params.Country.String, result.Country)
+	require.Equal(t, testUser.LastName, result.LastName)
+	require.Equal(t, testUser.Nickname, result.Nickname)
+	require.Equal(t, testUser.Password, result.Password)
+	require.Equal(t, testUser.Email, result.Email)
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	testUser := createTestUser(t)
+
+	result, err := testQueries.GetUserByEmail(context.Background(), strings.ToUpper(testUser.Email))
+	require.NoError(t, err)
+	require.Equal(t, testUser.ID, result.ID)
+
+	_, err = testQueries.GetUserByEmail(context.Background(), testUser.Nickname)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestGetUserByLogin(t *testing.T) {
+	testUser := createTestUser(t)
+
+	result, err := testQueries.GetUserByLogin(context.Background(), GetUserByLoginParams{
+		Nickname: testUser.Nickname,
+		Email:    testUser.Nickname,
+	})
+	require.NoError(t, err)
+	require.Equal(t, testUser.ID, result.ID)
+
+	result, err = testQueries.GetUserByLogin(context.Background(), GetUserByLoginParams{
+		Nickname: testUser.Email,
+		Email:    strings.ToUpper(testUser.Email),
+	})
+	require.NoError(t, err)
+	require.Equal(t, testUser.Email, result.Email)
+
+	login := util.RandomWord(12)
+	result, err = testQueries.GetUserByLogin(context.Background(), GetUserByLoginParams{Nickname: login, Email: login})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Empty(t, result)
+}
+
+func TestUniqueEmail(t *testing.T) {
+	testUser := createTestUser(t)
+
+	_, err := testQueries.CreateUser(context.Background(), CreateUserParams{
+		FirstName: util.RandomWord(5),
+		LastName:  util.RandomWord(5),
+		Nickname:  util.RandomWord(10),
+		Password:  util.RandomWord(5),
+		Email:     strings.ToUpper(testUser.Email),
+		Country:   util.RandomCountry(),
+	})
+	var pqErr *pq.Error
+	require.ErrorAs(t, err, &pqErr)
+	require.Equal(t, pq.ErrorCode("23505"), pqErr.Code)
+}
+
+func TestUpdateUserPassword(t *testing.T) {
+	testUser := createTestUser(t)
+
+	params := UpdateUserPasswordParams{
+		ID:       testUser.ID,
+		Password: util.RandomWord(10),
+	}
+
+	err := testQueries.UpdateUserPassword(context.Background(), params)
+	require.NoError(t, err)
+
+	result, err := testQueries.GetUser(context.Background(), testUser.ID)
+	require.NoError(t, err)
+	require.Equal(t, params.Password, result.Password)
+}
+
+// modifiedAtResolution is slept between creating and updating a user, so that now() of both transactions differs
+const modifiedAtResolution = 10 * time.Millisecond
+
+func TestUpdateUserAdvancesModifiedAt(t *testing.T) {
+	testUser := createTestUser(t)
+	require.Equal(t, testUser.CreatedAt, testUser.ModifiedAt)
+
+	time.Sleep(modifiedAtResolution)
+
+	result, err := testQueries.UpdateUser(context.Background(), UpdateUserParams{
+		ID:        testUser.ID,
+		Version:   testUser.Version,
+		FirstName: util.RandomWord(5),
+		LastName:  testUser.LastName,
+		Nickname:  testUser.Nickname,
+		Password:  testUser.Password,
+		Email:     testUser.Email,
+		Country:   testUser.Country,
+	})
+	require.NoError(t, err)
+	require.True(t, result.ModifiedAt.After(testUser.ModifiedAt))
+	require.Equal(t, testUser.CreatedAt, result.CreatedAt)
+}
+
+func TestPatchUserAdvancesModifiedAt(t *testing.T) {
+	testUser := createTestUser(t)
+
+	time.Sleep(modifiedAtResolution)
+
+	result, err := testQueries.PatchUser(context.Background(), PatchUserParams{
+		ID:       testUser.ID,
+		Version:  testUser.Version,
+		Nickname: sql.NullString{String: util.RandomWord(5), Valid: true},
+	})
+	require.NoError(t, err)
+	require.True(t, result.ModifiedAt.After(testUser.ModifiedAt))
+	require.Equal(t, testUser.CreatedAt, result.CreatedAt)
+
+	time.Sleep(modifiedAtResolution)
+
+	// patch which does not change anything keeps modified_at
+	unchanged, err := testQueries.PatchUser(context.Background(), PatchUserParams{ID: testUser.ID, Version: result.Version})
+	require.NoError(t, err)
+	require.Equal(t, result.ModifiedAt, unchanged.ModifiedAt)
+}
+
+func TestUpdateUserPasswordAdvancesModifiedAt(t *testing.T) {
+	testUser := createTestUser(t)
+
+	time.Sleep(modifiedAtResolution)
+
+	err := testQueries.UpdateUserPassword(context.Background(), UpdateUserPasswordParams{
+		ID:       testUser.ID,
+		Password: util.RandomWord(10),
+	})
+	require.NoError(t, err)
+
+	result, err := testQueries.GetUser(context.Background(), testUser.ID)
+	require.NoError(t, err)
+	require.True(t, result.ModifiedAt.After(testUser.ModifiedAt))
+}
+
 func TestListUsers(t *testing.T) {
 	n := 10
 
@@ -88,10 +241,317 @@ func TestListUsers(t *testing.T) {
 func TestDeleteUser(t *testing.T) {
 	testUser := createTestUser(t)
 
-	err := testQueries.DeleteUser(context.Background(), testUser.ID)
+	rows, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: testUser.ID, Version: testUser.Version})
 	require.NoError(t, err)
+	require.Equal(t, int64(1), rows)
 
 	result, err := testQueries.GetUser(context.Background(), testUser.ID)
 	require.Error(t, err, sql.ErrNoRows)
 	require.Empty(t, result)
+
+	rows, err = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: testUser.ID, Version: testUser.Version})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+}
+
+func TestDeletedUserIsHidden(t *testing.T) {
+	testUser := createTestUser(t)
+
+	rows, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: testUser.ID, Version: testUser.Version})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rows)
+
+	_, err = testQueries.GetUserByLogin(context.Background(), GetUserByLoginParams{
+		Nickname: testUser.Nickname,
+		Email:    testUser.Email,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = testQueries.PatchUser(context.Background(), PatchUserParams{
+		ID:        testUser.ID,
+		Version:   testUser.Version,
+		FirstName: sql.NullString{String: util.RandomWord(5), Valid: true},
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestRestoreUser(t *testing.T) {
+	testUser := createTestUser(t)
+
+	_, err := testQueries.RestoreUser(context.Background(), testUser.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: testUser.ID, Version: testUser.Version})
+	require.NoError(t, err)
+
+	result, err := testQueries.RestoreUser(context.Background(), testUser.ID)
+	require.NoError(t, err)
+	require.Equal(t, testUser.ID, result.ID)
+	require.False(t, result.DeletedAt.Valid)
+
+	result, err = testQueries.GetUser(context.Background(), testUser.ID)
+	require.NoError(t, err)
+	require.Equal(t, testUser.Nickname, result.Nickname)
+}
+
+func TestListUsersFilteredWithDeleted(t *testing.T) {
+	testUser := createTestUser(t)
+
+	_, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: testUser.ID, Version: testUser.Version})
+	require.NoError(t, err)
+
+	result, err := testQueries.ListUsersFiltered(context.Background(), ListUsersFilteredParams{
+		NicknamePrefix: testUser.Nickname,
+		IncludeDeleted: true,
+	})
+	require.NoError(t, err)
+
+	found := false
+	for _, v := range result {
+		if v.ID == testUser.ID {
+			found = true
+			require.True(t, v.DeletedAt.Valid)
+		}
+	}
+	require.True(t, found)
+
+	result, err = testQueries.ListUsersFiltered(context.Background(), ListUsersFilteredParams{
+		NicknamePrefix: testUser.Nickname,
+	})
+	require.NoError(t, err)
+	for _, v := range result {
+		require.NotEqual(t, testUser.ID, v.ID)
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	deletedUser := createTestUser(t)
+	activeUser := createTestUser(t)
+
+	_, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: deletedUser.ID, Version: deletedUser.Version})
+	require.NoError(t, err)
+
+	// users deleted within the retention window are kept
+	_, err = testQueries.PurgeDeletedUsers(context.Background(), time.Now().UTC().Add(-time.Hour))
+	require.NoError(t, err)
+	restored, err := testQueries.RestoreUser(context.Background(), deletedUser.ID)
+	require.NoError(t, err)
+
+	_, err = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: restored.ID, Version: restored.Version})
+	require.NoError(t, err)
+
+	rows, err := testQueries.PurgeDeletedUsers(context.Background(), time.Now().UTC().Add(time.Hour))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, rows, int64(1))
+
+	_, err = testQueries.RestoreUser(context.Background(), deletedUser.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	result, err := testQueries.GetUser(context.Background(), activeUser.ID)
+	require.NoError(t, err)
+	require.Equal(t, activeUser.ID, result.ID)
+}
+
+func TestUserVersion(t *testing.T) {
+	testUser := createTestUser(t)
+	require.Equal(t, int64(1), testUser.Version)
+
+	result, err := testQueries.PatchUser(context.Background(), PatchUserParams{
+		ID:        testUser.ID,
+		FirstName: sql.NullString{String: util.RandomWord(5), Valid: true},
+		Version:   testUser.Version,
+	})
+	require.NoError(t, err)
+	require.Equal(t, testUser.Version+1, result.Version)
+
+	// writes based on the stale version do not match any row
+	_, err = testQueries.PatchUser(context.Background(), PatchUserParams{
+		ID:       testUser.ID,
+		LastName: sql.NullString{String: util.RandomWord(5), Valid: true},
+		Version:  testUser.Version,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	rows, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: testUser.ID, Version: testUser.Version})
+	require.NoError(t, err)
+	require.Zero(t, rows)
+
+	// patch which does not change anything keeps the version
+	unchanged, err := testQueries.PatchUser(context.Background(), PatchUserParams{ID: testUser.ID, Version: result.Version})
+	require.NoError(t, err)
+	require.Equal(t, result.Version, unchanged.Version)
+}
+
+func TestListUsersFilteredAfterCursor(t *testing.T) {
+	first := createTestUser(t)
+	second := createTestUser(t)
+	third := createTestUser(t)
+
+	result, err := testQueries.ListUsersFiltered(context.Background(), ListUsersFilteredParams{
+		AfterCreatedAt: first.CreatedAt,
+		AfterID:        first.ID,
+		Limit:          2,
+	})
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	require.Equal(t, second.ID, result[0].ID)
+	require.Equal(t, third.ID, result[1].ID)
+
+	_, err = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: second.ID, Version: second.Version})
+	require.NoError(t, err)
+
+	result, err = testQueries.ListUsersFiltered(context.Background(), ListUsersFilteredParams{
+		AfterCreatedAt: first.CreatedAt,
+		AfterID:        first.ID,
+		Limit:          1,
+	})
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	require.Equal(t, third.ID, result[0].ID)
+
+	result, err = testQueries.ListUsersFiltered(context.Background(), ListUsersFilteredParams{
+		IncludeDeleted: true,
+		AfterCreatedAt: first.CreatedAt,
+		AfterID:        first.ID,
+		Limit:          1,
+	})
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	require.Equal(t, second.ID, result[0].ID)
+}
+
+func TestListUsersFiltered(t *testing.T) {
+	testUser := createTestUser(t)
+
+	result, err := testQueries.ListUsersFiltered(context.Background(), ListUsersFilteredParams{
+		Country:        testUser.Country,
+		EmailDomain:    strings.ToUpper(testUser.Email[strings.Index(testUser.Email, "@")+1:]),
+		NicknamePrefix: testUser.Nickname[:3],
+		CreatedFrom:    testUser.CreatedAt,
+		CreatedTo:      testUser.CreatedAt.Add(time.Second),
+		Sort:           []UserSort{{Field: "last_name", Descending: true}, {Field: "created_at"}},
+	})
+	require.NoError(t, err)
+
+	found := false
+	for i, v := range result {
+		require.Equal(t, testUser.Country, v.Country)
+		require.True(t, strings.HasPrefix(v.Nickname, testUser.Nickname[:3]))
+		if i > 0 {
+			require.GreaterOrEqual(t, result[i-1].LastName, v.LastName)
+		}
+		found = found || v.ID == testUser.ID
+	}
+	require.True(t, found)
+
+	result, err = testQueries.ListUsersFiltered(context.Background(), ListUsersFilteredParams{
+		NicknamePrefix: testUser.Nickname,
+		CreatedFrom:    testUser.CreatedAt.Add(time.Second),
+	})
+	require.NoError(t, err)
+	require.Empty(t, result)
+}
+
+func TestSearchUsers(t *testing.T) {
+	testUser := createTestUser(t)
+
+	// full-text search matches whole words
+	result, err := testQueries.SearchUsers(context.Background(), SearchUsersParams{
+		Query:    testUser.LastName,
+		RowLimit: 100,
+	})
+	require.NoError(t, err)
+
+	found := false
+	for _, v := range result {
+		if v.ID == testUser.ID {
+			found = true
+			require.Positive(t, v.Rank)
+			require.Contains(t, v.LastNameHeadline, "\ue000")
+		}
+	}
+	require.True(t, found)
+
+	// misspelled nickname is still found by trigram similarity
+	misspelled := testUser.Nickname[:4] + "x"
+	result, err = testQueries.SearchUsers(context.Background(), SearchUsersParams{
+		Query:    misspelled,
+		RowLimit: 100,
+	})
+	require.NoError(t, err)
+
+	found = false
+	for i, v := range result {
+		if i > 0 {
+			require.GreaterOrEqual(t, result[i-1].Rank, v.Rank)
+		}
+		if v.ID == testUser.ID {
+			found = true
+			require.True(t, v.NicknameSimilar)
+		}
+	}
+	require.True(t, found)
+}
+
+func TestCountUsersFiltered(t *testing.T) {
+	testUser := createTestUser(t)
+
+	count, err := testQueries.CountUsersFiltered(context.Background(), ListUsersFilteredParams{
+		NicknamePrefix: testUser.Nickname,
+		Limit:          1,
+		Offset:         10,
+	})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, count, int64(1))
+
+	total, err := testQueries.CountUsersFiltered(context.Background(), ListUsersFilteredParams{})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, total, count)
+}
+
+func TestEstimateUsers(t *testing.T) {
+	createTestUser(t)
+
+	_, err := testDB.Exec("ANALYZE users")
+	require.NoError(t, err)
+
+	estimate, err := testQueries.EstimateUsers(context.Background(), true)
+	require.NoError(t, err)
+	require.Positive(t, estimate)
+
+	var deleted int64
+	err = testDB.QueryRow("SELECT count(*) FROM users WHERE deleted_at IS NOT NULL").Scan(&deleted)
+	require.NoError(t, err)
+
+	// deleted users are subtracted from the same statistics
+	withoutDeleted, err := testQueries.EstimateUsers(context.Background(), false)
+	require.NoError(t, err)
+	require.Equal(t, estimate-deleted, withoutDeleted)
+}
+
+func TestCountUsersBreakingGmailRules(t *testing.T) {
+	before, err := testQueries.CountUsersBreakingGmailRules(context.Background())
+	require.NoError(t, err)
+
+	for _, email := range []string{
+		util.RandomWord(10) + "@gmail.com",
+		util.RandomWord(5) + "." + util.RandomWord(5) + "@gmail.com",
+		util.RandomWord(10) + "+tag@gmail.com",
+		util.RandomWord(10) + "@googlemail.com",
+		util.RandomWord(5) + "." + util.RandomWord(5) + "@example.com",
+	} {
+		_, err := testQueries.CreateUser(context.Background(), CreateUserParams{
+			FirstName: util.RandomWord(5),
+			LastName:  util.RandomWord(5),
+			Nickname:  util.RandomWord(5),
+			Password:  util.RandomWord(5),
+			Email:     email,
+			Country:   util.RandomCountry(),
+		})
+		require.NoError(t, err)
+	}
+
+	after, err := testQueries.CountUsersBreakingGmailRules(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, before+3, after)
 }
@@ -0,0 +1,46 @@
+// Package email normalizes email addresses, so that one mailbox can not be registered under different spellings
+package email
+
+import (
+	"strings"
+)
+
+// gmailDomains are domains of Gmail mailboxes, both deliver to the same mailbox
+var gmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// Normalizer normalizes email addresses
+type Normalizer struct {
+	// ProviderRules enables rules of providers which ignore parts of the address, e.g. Gmail ignores dots
+	// and everything after + in the local part
+	ProviderRules bool
+}
+
+// NewNormalizer creates a new Normalizer
+func NewNormalizer(providerRules bool) Normalizer {
+	return Normalizer{ProviderRules: providerRules}
+}
+
+// Normalize trims the address and lower cases its domain, the local part keeps its case since it can be
+// case-sensitive, addresses without domain are only trimmed
+func (n Normalizer) Normalize(address string) string {
+	address = strings.TrimSpace(address)
+
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return address
+	}
+	local, domain := address[:at], strings.ToLower(address[at+1:])
+
+	if n.ProviderRules && gmailDomains[domain] {
+		if plus := strings.Index(local, "+"); plus >= 0 {
+			local = local[:plus]
+		}
+		local = strings.ToLower(strings.ReplaceAll(local, ".", ""))
+		domain = "gmail.com"
+	}
+
+	return local + "@" + domain
+}
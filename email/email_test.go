@@ -0,0 +1,30 @@
+package email
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		name          string
+		address       string
+		providerRules bool
+		want          string
+	}{
+		{name: "Trimmed", address: "  bob@example.com\n", want: "bob@example.com"},
+		{name: "Domain Lower Cased", address: "Bob@X.COM", want: "Bob@x.com"},
+		{name: "Gmail Without Rules", address: "J.Doe+news@GMail.com", want: "J.Doe+news@gmail.com"},
+		{name: "Gmail", address: "J.Doe+news@GMail.com", providerRules: true, want: "jdoe@gmail.com"},
+		{name: "Googlemail", address: "jdoe@googlemail.com", providerRules: true, want: "jdoe@gmail.com"},
+		{name: "Other Provider", address: "j.doe+news@example.com", providerRules: true, want: "j.doe+news@example.com"},
+		{name: "Quoted Local Part", address: `"a@b"@Example.com`, want: `"a@b"@example.com`},
+		{name: "Nickname", address: " bob ", want: "bob"},
+	}
+
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			require.Equal(t, v.want, NewNormalizer(v.providerRules).Normalize(v.address))
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Package lockout counts failed logins and temporarily locks keys, e.g. accounts or client IPs, which fail too often
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"strings"
+	"time"
+)
+
+// Supported stores
+const (
+	Postgres = "postgres"
+	Memory   = "memory"
+)
+
+// Attempts holds failed logins of a single key
+type Attempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	// LockedUntil is zero when the key was never locked
+	LockedUntil time.Time
+}
+
+// Store is an interface for keeping failed logins, it has to be shared by all instances of the server
+// so that attackers can not spread their attempts across them
+type Store interface {
+	// Get returns attempts of the key, keys without failures have zero Attempts
+	Get(ctx context.Context, key string) (Attempts, error)
+	// RecordFailure atomically adds a failure of the key which happened at failedAt, failures are counted
+	// from one again when the last one happened before resetBefore
+	RecordFailure(ctx context.Context, key string, failedAt time.Time, resetBefore time.Time) (Attempts, error)
+	// Lock locks the key until the time, a later lock of the key is kept
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets failures and the lock of the key
+	Reset(ctx context.Context, key string) error
+}
+
+// NewStore creates a Store selected in config, queries are used by the Postgres store
+func NewStore(kind string, queries db.Querier) (Store, error) {
+	switch strings.ToLower(kind) {
+	case Postgres:
+		return NewPostgresStore(queries), nil
+	case Memory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unsupported lockout store: %q", kind)
+	}
+}
+
+// Policy describes how failures of a key lock it
+type Policy struct {
+	// FreeAttempts is the number of failures which do not lock the key
+	FreeAttempts int
+	// BaseDelay is how long the key is locked after the first failure over FreeAttempts, every next failure
+	// doubles it up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ResetAfter forgets failures of keys which have not failed for that long
+	ResetAfter time.Duration
+}
+
+// Delay returns how long the key is locked after its failures
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay
+}
+
+// Lockout applies the policy to keys kept in the store
+type Lockout struct {
+	store  Store
+	policy Policy
+	// now returns the current time, tests replace it to move the clock
+	now func() time.Time
+}
+
+// NewLockout creates a new Lockout
+func NewLockout(store Store, policy Policy) (*Lockout, error) {
+	if policy.FreeAttempts < 1 {
+		return nil, errors.New("free attempts have to be positive")
+	}
+	if policy.BaseDelay <= 0 || policy.MaxDelay < policy.BaseDelay {
+		return nil, fmt.Errorf("invalid delays, base %s, max %s", policy.BaseDelay, policy.MaxDelay)
+	}
+	if policy.ResetAfter < policy.MaxDelay {
+		return nil, fmt.Errorf("failures have to be kept for at least the max delay %s", policy.MaxDelay)
+	}
+
+	return &Lockout{
+		store:  store,
+		policy: policy,
+		now:    time.Now,
+	}, nil
+}
+
+// Check returns how long the key stays locked, zero when it is not locked
+func (l *Lockout) Check(ctx context.Context, key string) (time.Duration, error) {
+	attempts, err := l.store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	now := l.now()
+	if !attempts.LockedUntil.After(now) {
+		return 0, nil
+	}
+
+	return attempts.LockedUntil.Sub(now), nil
+}
+
+// Fail records a failure of the key and locks it when it failed too often, the returned Attempts have
+// LockedUntil set when this failure locked the key
+func (l *Lockout) Fail(ctx context.Context, key string) (Attempts, error) {
+	now := l.now()
+	attempts, err := l.store.RecordFailure(ctx, key, now, now.Add(-l.policy.ResetAfter))
+	if err != nil {
+		return Attempts{}, err
+	}
+
+	attempts.LockedUntil = time.Time{}
+	if delay := l.policy.Delay(attempts.Failures); delay > 0 {
+		attempts.LockedUntil = now.Add(delay)
+		err = l.store.Lock(ctx, key, attempts.LockedUntil)
+		if err != nil {
+			return Attempts{}, err
+		}
+	}
+
+	return attempts, nil
+}
+
+// Status returns attempts of the key, they are zero when its failures are old enough to be forgotten
+func (l *Lockout) Status(ctx context.Context, key string) (Attempts, error) {
+	attempts, err := l.store.Get(ctx, key)
+	if err != nil {
+		return Attempts{}, err
+	}
+
+	now := l.now()
+	if attempts.LastFailureAt.Before(now.Add(-l.policy.ResetAfter)) && !attempts.LockedUntil.After(now) {
+		return Attempts{Key: key}, nil
+	}
+
+	return attempts, nil
+}
+
+// Reset forgets failures and the lock of the key, e.g. after a successful login
+func (l *Lockout) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, key)
+}
@@ -0,0 +1,196 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Minute,
+	MaxDelay:     10 * time.Minute,
+	ResetAfter:   time.Hour,
+}
+
+func newTestLockout(t *testing.T) (*Lockout, *time.Time) {
+	lockout, err := NewLockout(NewMemoryStore(), testPolicy)
+	require.NoError(t, err)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	lockout.now = func() time.Time {
+		return now
+	}
+
+	return lockout, &now
+}
+
+func TestPolicyDelay(t *testing.T) {
+	require.Zero(t, testPolicy.Delay(0))
+	require.Zero(t, testPolicy.Delay(3))
+	require.Equal(t, time.Minute, testPolicy.Delay(4))
+	require.Equal(t, 2*time.Minute, testPolicy.Delay(5))
+	require.Equal(t, 8*time.Minute, testPolicy.Delay(7))
+	require.Equal(t, 10*time.Minute, testPolicy.Delay(8))
+	require.Equal(t, 10*time.Minute, testPolicy.Delay(1000))
+}
+
+func TestNewLockout(t *testing.T) {
+	_, err := NewLockout(NewMemoryStore(), Policy{FreeAttempts: 0, BaseDelay: time.Minute, MaxDelay: time.Minute, ResetAfter: time.Hour})
+	require.Error(t, err)
+
+	_, err = NewLockout(NewMemoryStore(), Policy{FreeAttempts: 1, BaseDelay: time.Hour, MaxDelay: time.Minute, ResetAfter: time.Hour})
+	require.Error(t, err)
+
+	_, err = NewLockout(NewMemoryStore(), Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: time.Minute})
+	require.Error(t, err)
+}
+
+func TestLockout(t *testing.T) {
+	lockout, now := newTestLockout(t)
+	ctx := context.Background()
+
+	for i := 1; i <= testPolicy.FreeAttempts; i++ {
+		attempts, err := lockout.Fail(ctx, "key")
+		require.NoError(t, err)
+		require.Equal(t, i, attempts.Failures)
+		require.True(t, attempts.LockedUntil.IsZero())
+	}
+
+	retryAfter, err := lockout.Check(ctx, "key")
+	require.NoError(t, err)
+	require.Zero(t, retryAfter)
+
+	attempts, err := lockout.Fail(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Minute), attempts.LockedUntil)
+
+	retryAfter, err = lockout.Check(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, retryAfter)
+
+	// other keys are not affected
+	retryAfter, err = lockout.Check(ctx, "other")
+	require.NoError(t, err)
+	require.Zero(t, retryAfter)
+
+	// the next failure after the lock doubles the delay
+	*now = now.Add(time.Minute)
+	retryAfter, err = lockout.Check(ctx, "key")
+	require.NoError(t, err)
+	require.Zero(t, retryAfter)
+
+	attempts, err = lockout.Fail(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, now.Add(2*time.Minute), attempts.LockedUntil)
+
+	err = lockout.Reset(ctx, "key")
+	require.NoError(t, err)
+
+	retryAfter, err = lockout.Check(ctx, "key")
+	require.NoError(t, err)
+	require.Zero(t, retryAfter)
+}
+
+func TestLockoutResetAfter(t *testing.T) {
+	lockout, now := newTestLockout(t)
+	ctx := context.Background()
+
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		_, err := lockout.Fail(ctx, "key")
+		require.NoError(t, err)
+	}
+
+	*now = now.Add(testPolicy.ResetAfter + time.Second)
+
+	status, err := lockout.Status(ctx, "key")
+	require.NoError(t, err)
+	require.Zero(t, status.Failures)
+
+	attempts, err := lockout.Fail(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts.Failures)
+	require.True(t, attempts.LockedUntil.IsZero())
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := store.RecordFailure(ctx, "old", now, now.Add(-time.Hour))
+	require.NoError(t, err)
+
+	_, err = store.RecordFailure(ctx, "new", now.Add(2*time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, store.attempts, 1)
+	require.Contains(t, store.attempts, "new")
+}
+
+func TestNewStore(t *testing.T) {
+	store, err := NewStore("Memory", nil)
+	require.NoError(t, err)
+	require.IsType(t, &MemoryStore{}, store)
+
+	store, err = NewStore(Postgres, nil)
+	require.NoError(t, err)
+	require.IsType(t, &PostgresStore{}, store)
+
+	_, err = NewStore("redis", nil)
+	require.Error(t, err)
+}
+
+func TestPostgresStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	queries := mockdb.NewMockStore(ctrl)
+	store := NewPostgresStore(queries)
+	ctx := context.Background()
+
+	failedAt := time.Date(2022, 1, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600))
+	lockedUntil := failedAt.Add(time.Minute)
+
+	queries.EXPECT().GetLoginAttempt(gomock.Any(), gomock.Eq("missing")).
+		Times(1).
+		Return(db.LoginAttempt{}, sql.ErrNoRows)
+	queries.EXPECT().RecordLoginFailure(gomock.Any(), gomock.Eq(db.RecordLoginFailureParams{
+		Key:         "key",
+		FailedAt:    failedAt.UTC(),
+		ResetBefore: failedAt.Add(-time.Hour).UTC(),
+	})).
+		Times(1).
+		Return(db.LoginAttempt{Key: "key", Failures: 4, LastFailureAt: failedAt.UTC()}, nil)
+	queries.EXPECT().LockLoginAttempt(gomock.Any(), gomock.Eq(db.LockLoginAttemptParams{LockedUntil: lockedUntil.UTC(), Key: "key"})).
+		Times(1).
+		Return(nil)
+	queries.EXPECT().GetLoginAttempt(gomock.Any(), gomock.Eq("key")).
+		Times(1).
+		Return(db.LoginAttempt{Key: "key", Failures: 4, LockedUntil: sql.NullTime{Time: lockedUntil.UTC(), Valid: true}}, nil)
+	queries.EXPECT().DeleteLoginAttempt(gomock.Any(), gomock.Eq("key")).
+		Times(1).
+		Return(nil)
+
+	attempts, err := store.Get(ctx, "missing")
+	require.NoError(t, err)
+	require.Equal(t, Attempts{Key: "missing"}, attempts)
+
+	attempts, err = store.RecordFailure(ctx, "key", failedAt, failedAt.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 4, attempts.Failures)
+	require.True(t, attempts.LockedUntil.IsZero())
+
+	require.NoError(t, store.Lock(ctx, "key", lockedUntil))
+
+	attempts, err = store.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, lockedUntil.Equal(attempts.LockedUntil))
+
+	require.NoError(t, store.Reset(ctx, "key"))
+}
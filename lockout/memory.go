@@ -0,0 +1,83 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps attempts in memory, it is meant for tests and single instance deployments since
+// every instance of the server would count failures on its own
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+}
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]Attempts)}
+}
+
+// Get returns attempts of the key
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok {
+		return Attempts{Key: key}, nil
+	}
+
+	return attempts, nil
+}
+
+// RecordFailure adds a failure of the key, keys whose failures are forgotten and whose locks ended are swept
+// on the way so that the map does not grow with keys which are never seen again
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, failedAt time.Time, resetBefore time.Time) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range s.attempts {
+		if v.LastFailureAt.Before(resetBefore) && !v.LockedUntil.After(failedAt) {
+			delete(s.attempts, k)
+		}
+	}
+
+	attempts, ok := s.attempts[key]
+	if !ok || attempts.LastFailureAt.Before(resetBefore) {
+		attempts = Attempts{Key: key, LockedUntil: attempts.LockedUntil}
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = failedAt
+	s.attempts[key] = attempts
+
+	return attempts, nil
+}
+
+// Lock locks the key until the time unless it is locked even longer
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+
+	if until.After(attempts.LockedUntil) {
+		attempts.LockedUntil = until
+		s.attempts[key] = attempts
+	}
+
+	return nil
+}
+
+// Reset forgets the key
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
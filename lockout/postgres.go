@@ -0,0 +1,72 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"time"
+)
+
+// PostgresStore keeps attempts in the login_attempts table, so that all instances of the server share them
+type PostgresStore struct {
+	queries db.Querier
+}
+
+// NewPostgresStore creates a new PostgresStore
+func NewPostgresStore(queries db.Querier) *PostgresStore {
+	return &PostgresStore{queries: queries}
+}
+
+// Get returns attempts of the key
+func (s *PostgresStore) Get(ctx context.Context, key string) (Attempts, error) {
+	attempt, err := s.queries.GetLoginAttempt(ctx, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Attempts{Key: key}, nil
+		}
+		return Attempts{}, err
+	}
+
+	return newAttempts(attempt), nil
+}
+
+// RecordFailure adds a failure of the key, times are stored in UTC like other timestamps of the database
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, failedAt time.Time, resetBefore time.Time) (Attempts, error) {
+	attempt, err := s.queries.RecordLoginFailure(ctx, db.RecordLoginFailureParams{
+		Key:         key,
+		FailedAt:    failedAt.UTC(),
+		ResetBefore: resetBefore.UTC(),
+	})
+	if err != nil {
+		return Attempts{}, err
+	}
+
+	return newAttempts(attempt), nil
+}
+
+// Lock locks the key until the time unless it is locked even longer
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.queries.LockLoginAttempt(ctx, db.LockLoginAttemptParams{
+		LockedUntil: until.UTC(),
+		Key:         key,
+	})
+}
+
+// Reset deletes the key
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.queries.DeleteLoginAttempt(ctx, key)
+}
+
+func newAttempts(attempt db.LoginAttempt) Attempts {
+	attempts := Attempts{
+		Key:           attempt.Key,
+		Failures:      int(attempt.Failures),
+		LastFailureAt: attempt.LastFailureAt,
+	}
+	if attempt.LockedUntil.Valid {
+		attempts.LockedUntil = attempt.LockedUntil.Time
+	}
+
+	return attempts
+}
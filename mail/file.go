@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message into its own .eml file instead of sending it, so that emails can be read
+// during local development without a mail server
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+// NewFileMailer creates a new FileMailer, the directory is created when it does not exist
+func NewFileMailer(from string, dir string) (*FileMailer, error) {
+	if from == "" {
+		return nil, errors.New("mail sender is required")
+	}
+	if dir == "" {
+		return nil, errors.New("mail directory is required")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create mail directory: %w", err)
+	}
+
+	return &FileMailer{from: from, dir: dir}, nil
+}
+
+// Send writes the message into a file named after the time it was sent, the files may contain secrets
+// like verification links so only their owner can read them
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	data, err := encode(m.from, message, now)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0600)
+}
@@ -0,0 +1,88 @@
+// Package mail sends emails to users, e.g. links verifying their addresses
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+)
+
+// Supported mailers
+const (
+	SMTP   = "smtp"
+	File   = "file"
+	Memory = "memory"
+)
+
+// ErrInvalidHeader is returned when an address or the subject contains line breaks, which could inject headers
+var ErrInvalidHeader = errors.New("mail header contains line break")
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is an interface for sending emails
+type Mailer interface {
+	// Send delivers the message, its sender is chosen by the mailer
+	Send(ctx context.Context, message Message) error
+}
+
+// SMTPConfig holds the server SMTPMailer delivers messages through
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// NewMailer creates a Mailer selected in config, from is the sender of all messages and dir is the directory
+// messages of the file mailer are written into
+func NewMailer(kind string, from string, smtpConfig SMTPConfig, dir string) (Mailer, error) {
+	switch strings.ToLower(kind) {
+	case SMTP:
+		return NewSMTPMailer(from, smtpConfig)
+	case File:
+		return NewFileMailer(from, dir)
+	case Memory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unsupported mailer: %q", kind)
+	}
+}
+
+// encode formats the message as RFC 5322 email, the body is quoted-printable so that it is 7-bit clean
+func encode(from string, message Message, date time.Time) ([]byte, error) {
+	for _, header := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "From: %s\r\n", from)
+	fmt.Fprintf(&buffer, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	writer := quotedprintable.NewWriter(&buffer)
+	body := strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,242 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testFrom = "User API <no-reply@example.com>"
+
+var testMessage = Message{
+	To:      "bob@example.com",
+	Subject: "Zweryfikuj adres e-mail – ąę",
+	Body:    "Cześć Bob,\nhttps://example.com/verify-email?token=" + strings.Repeat("a", 100) + "\n",
+}
+
+// requireMessage parses the email and checks it holds testMessage
+func requireMessage(t *testing.T, data []byte) {
+	parsed, err := netmail.ReadMessage(strings.NewReader(string(data)))
+	require.NoError(t, err)
+
+	require.Equal(t, testFrom, parsed.Header.Get("From"))
+	require.Equal(t, testMessage.To, parsed.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, testMessage.Subject, subject)
+	_, err = parsed.Header.Date()
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	require.NoError(t, err)
+	require.Equal(t, strings.ReplaceAll(testMessage.Body, "\n", "\r\n"), string(body))
+}
+
+func TestEncode(t *testing.T) {
+	data, err := encode(testFrom, testMessage, time.Now())
+	require.NoError(t, err)
+	requireMessage(t, data)
+
+	for _, line := range strings.Split(string(data), "\r\n") {
+		require.LessOrEqual(t, len(line), 76)
+		for _, r := range line {
+			require.Less(t, r, rune(128))
+		}
+	}
+
+	injected := testMessage
+	injected.Subject = "Hello\r\nBcc: eve@example.com"
+	_, err = encode(testFrom, injected, time.Now())
+	require.ErrorIs(t, err, ErrInvalidHeader)
+
+	injected = testMessage
+	injected.To = "bob@example.com\nBcc: eve@example.com"
+	_, err = encode(testFrom, injected, time.Now())
+	require.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestNewMailer(t *testing.T) {
+	mailer, err := NewMailer("Memory", testFrom, SMTPConfig{}, "")
+	require.NoError(t, err)
+	require.IsType(t, &MemoryMailer{}, mailer)
+
+	mailer, err = NewMailer(File, testFrom, SMTPConfig{}, t.TempDir())
+	require.NoError(t, err)
+	require.IsType(t, &FileMailer{}, mailer)
+
+	mailer, err = NewMailer(SMTP, testFrom, SMTPConfig{Host: "localhost", Port: 25}, "")
+	require.NoError(t, err)
+	require.IsType(t, &SMTPMailer{}, mailer)
+
+	_, err = NewMailer(SMTP, testFrom, SMTPConfig{}, "")
+	require.Error(t, err)
+
+	_, err = NewMailer(SMTP, "no-reply", SMTPConfig{Host: "localhost", Port: 25}, "")
+	require.Error(t, err)
+
+	_, err = NewMailer(File, testFrom, SMTPConfig{}, "")
+	require.Error(t, err)
+
+	_, err = NewMailer("sendmail", testFrom, SMTPConfig{}, "")
+	require.Error(t, err)
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := NewMemoryMailer()
+	require.Empty(t, mailer.Messages())
+
+	require.NoError(t, mailer.Send(context.Background(), testMessage))
+	messages := mailer.Messages()
+	require.Equal(t, []Message{testMessage}, messages)
+
+	messages[0].To = "eve@example.com"
+	require.Equal(t, testMessage, mailer.Messages()[0])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, mailer.Send(ctx, testMessage), context.Canceled)
+	require.Len(t, mailer.Messages(), 1)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := NewFileMailer(testFrom, dir)
+	require.NoError(t, err)
+
+	require.NoError(t, mailer.Send(context.Background(), testMessage))
+	require.NoError(t, mailer.Send(context.Background(), testMessage))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	info, err := os.Stat(files[0])
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	requireMessage(t, data)
+}
+
+// smtpEnvelope is the message received by serveSMTP together with its envelope sender
+type smtpEnvelope struct {
+	sender string
+	data   string
+}
+
+// serveSMTP accepts single SMTP session and returns the message it received, the server supports neither
+// extensions nor authentication
+func serveSMTP(listener net.Listener) <-chan smtpEnvelope {
+	received := make(chan smtpEnvelope, 1)
+	go func() {
+		defer close(received)
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var data strings.Builder
+		sender := ""
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					reply("250 OK")
+					received <- smtpEnvelope{sender: sender, data: data.String()}
+					continue
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+				continue
+			}
+
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				sender = strings.TrimSpace(line)[len("MAIL FROM:"):]
+				reply("250 OK")
+			case command == "DATA":
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	received := serveSMTP(listener)
+
+	address := listener.Addr().(*net.TCPAddr)
+	mailer, err := NewSMTPMailer(testFrom, SMTPConfig{Host: address.IP.String(), Port: address.Port})
+	require.NoError(t, err)
+	require.NoError(t, mailer.Send(context.Background(), testMessage))
+
+	select {
+	case envelope := <-received:
+		require.Equal(t, "<no-reply@example.com>", envelope.sender)
+		requireMessage(t, []byte(envelope.data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not received")
+	}
+}
+
+func TestSMTPMailerTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// the server accepts the connection but never greets the client
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	mailer, err := NewSMTPMailer(testFrom, SMTPConfig{Host: address.IP.String(), Port: address.Port})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = mailer.Send(ctx, testMessage)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,151 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer delivers messages through SMTP server, it upgrades the connection with STARTTLS when the server
+// supports it and authenticates only when username is set
+type SMTPMailer struct {
+	from string
+	// sender is the bare address of from, it is the envelope sender of the messages
+	sender  string
+	host    string
+	address string
+	auth    smtp.Auth
+}
+
+// smtpTimeout limits the whole SMTP session when the context has no earlier deadline, so that a slow or hung
+// server can not block senders forever
+const smtpTimeout = 30 * time.Second
+
+// NewSMTPMailer creates a new SMTPMailer
+func NewSMTPMailer(from string, config SMTPConfig) (*SMTPMailer, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail sender: %w", err)
+	}
+	if config.Host == "" || config.Port <= 0 {
+		return nil, fmt.Errorf("invalid smtp server %q:%d", config.Host, config.Port)
+	}
+
+	mailer := &SMTPMailer{
+		from:    from,
+		sender:  sender.Address,
+		host:    config.Host,
+		address: net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+	}
+	if config.Username != "" {
+		mailer.auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	return mailer, nil
+}
+
+// Send delivers the message, the session is aborted when the context is done or smtpTimeout passes
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := encode(m.from, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(smtpTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", m.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp does not take a context, moving the deadline interrupts whatever the session is waiting for
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	err = m.send(conn, message.To, data)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// send runs the SMTP session over conn, it follows smtp.SendMail
+func (m *SMTPMailer) send(conn net.Conn, to string, data []byte) error {
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: m.host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support authentication")
+		}
+		err = client.Auth(m.auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(m.sender)
+	if err != nil {
+		return err
+	}
+
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
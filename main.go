@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"github.com/rafdekar/user-api/api"
 	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/rafdekar/user-api/purge"
 	"github.com/rafdekar/user-api/util"
 	"log"
 
@@ -21,7 +23,28 @@ func main() {
 		log.Fatalln("db connection could not be established: ", err)
 	}
 
-	server := api.NewServer(db.New(conn))
+	store := db.NewStore(conn)
+
+	if config.EmailProviderRules {
+		count, err := store.CountUsersBreakingGmailRules(context.Background())
+		if err != nil {
+			log.Fatalln("stored emails could not be checked: ", err)
+		}
+		if count > 0 {
+			log.Fatalf("EMAIL_PROVIDER_RULES can not be enabled, %d stored Gmail addresses do not follow them", count)
+		}
+	}
+
+	purger, err := purge.NewPurger(store, config.SoftDeleteRetention, config.LockoutFailureRetention, config.PurgeInterval)
+	if err != nil {
+		log.Fatalln("purge job could not be created: ", err)
+	}
+	go purger.Run(context.Background())
+
+	server, err := api.NewServer(config, store)
+	if err != nil {
+		log.Fatalln("server could not be created: ", err)
+	}
 
 	err = server.Start(config.ServerAddress)
 	if err != nil {
@@ -0,0 +1,138 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idPrefix  = "$argon2id$"
+	argon2SaltLen   = 16
+	argon2KeyLen    = 32
+	argon2idVersion = argon2.Version
+)
+
+// Argon2idParams keeps the cost parameters of argon2id
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// Argon2idHasher hashes passwords with argon2id
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher creates a new Argon2idHasher with given parameters
+func NewArgon2idHasher(params Argon2idParams) (*Argon2idHasher, error) {
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return nil, errors.New("invalid argon2id parameters: memory, iterations and parallelism must be positive")
+	}
+
+	return &Argon2idHasher{params: params}, nil
+}
+
+// Hash returns argon2id hash of the password in PHC string format, e.g. "$argon2id$v=19$m=65536,t=3,p=2$salt$key"
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("could not generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, argon2KeyLen)
+
+	return encodeArgon2id(h.params, salt, key), nil
+}
+
+// Verify checks if password matches the encoded hash
+func (h *Argon2idHasher) Verify(hash string, password string) error {
+	return verify(hash, password)
+}
+
+// NeedsRehash reports whether hash is not an argon2id hash of the current parameters
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	if !isArgon2idHash(hash) {
+		return true
+	}
+
+	params, _, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params != h.params || len(key) != argon2KeyLen
+}
+
+func isArgon2idHash(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func verifyArgon2id(hash string, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return ErrMismatchedPassword
+	}
+
+	return nil
+}
+
+func encodeArgon2id(params Argon2idParams, salt []byte, key []byte) string {
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2idVersion,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2id(hash string) (params Argon2idParams, salt []byte, key []byte, err error) {
+	// "$argon2id$v=19$m=65536,t=3,p=2$salt$key" splits into ["", "argon2id", "v=19", "m=...", "salt", "key"]
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		err = ErrUnknownHashFormat
+		return
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		err = ErrUnknownHashFormat
+		return
+	}
+	if version != argon2idVersion {
+		err = fmt.Errorf("unsupported argon2id version: %d", version)
+		return
+	}
+
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		err = ErrUnknownHashFormat
+		return
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		err = ErrUnknownHashFormat
+		return
+	}
+
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		err = ErrUnknownHashFormat
+		return
+	}
+
+	return
+}
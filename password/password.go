@@ -0,0 +1,66 @@
+package password
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Supported hashing algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+var (
+	// ErrMismatchedPassword is returned when password does not match the stored hash
+	ErrMismatchedPassword = errors.New("password does not match")
+	// ErrUnknownHashFormat is returned when stored hash was not produced by any of the supported algorithms
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+)
+
+// Hasher is an interface for hashing and verifying user passwords
+type Hasher interface {
+	// Hash returns encoded hash of the password, prefixed with the algorithm and its parameters
+	Hash(password string) (string, error)
+	// Verify checks if password matches the encoded hash, no matter which of the supported algorithms produced it,
+	// values without any known prefix are plaintext passwords stored before passwords were hashed
+	Verify(hash string, password string) error
+	// NeedsRehash reports whether encoded hash was produced with different algorithm or parameters than the current ones
+	NeedsRehash(hash string) bool
+}
+
+// NewHasher creates a Hasher for the algorithm selected in config
+func NewHasher(algorithm string, bcryptCost int, argon2Params Argon2idParams) (Hasher, error) {
+	switch strings.ToLower(algorithm) {
+	case Bcrypt:
+		return NewBcryptHasher(bcryptCost)
+	case Argon2id:
+		return NewArgon2idHasher(argon2Params)
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm: %q", algorithm)
+	}
+}
+
+// verify checks password against encoded hash using the algorithm stored in its prefix
+func verify(hash string, password string) error {
+	switch {
+	case isBcryptHash(hash):
+		return verifyBcrypt(hash, password)
+	case isArgon2idHash(hash):
+		return verifyArgon2id(hash, password)
+	default:
+		return verifyPlaintext(hash, password)
+	}
+}
+
+// verifyPlaintext compares password with a legacy plaintext one in constant time, such passwords always need
+// a rehash so they are hashed on the first successful login
+func verifyPlaintext(stored string, password string) error {
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(password)) != 1 {
+		return ErrMismatchedPassword
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+}
+
+func TestBcryptHasher(t *testing.T) {
+	hasher, err := NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+
+	password := util.RandomWord(10)
+
+	hash, err := hasher.Hash(password)
+	require.NoError(t, err)
+	require.NotEqual(t, password, hash)
+	require.True(t, strings.HasPrefix(hash, "$2a$04$"))
+
+	require.NoError(t, hasher.Verify(hash, password))
+	require.ErrorIs(t, hasher.Verify(hash, util.RandomWord(10)), ErrMismatchedPassword)
+	require.False(t, hasher.NeedsRehash(hash))
+
+	otherHasher, err := NewBcryptHasher(bcrypt.MinCost + 1)
+	require.NoError(t, err)
+	require.True(t, otherHasher.NeedsRehash(hash))
+
+	_, err = NewBcryptHasher(bcrypt.MaxCost + 1)
+	require.Error(t, err)
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher, err := NewArgon2idHasher(testArgon2idParams)
+	require.NoError(t, err)
+
+	password := util.RandomWord(10)
+
+	hash, err := hasher.Hash(password)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	secondHash, err := hasher.Hash(password)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, secondHash)
+
+	require.NoError(t, hasher.Verify(hash, password))
+	require.ErrorIs(t, hasher.Verify(hash, util.RandomWord(10)), ErrMismatchedPassword)
+	require.False(t, hasher.NeedsRehash(hash))
+
+	otherHasher, err := NewArgon2idHasher(Argon2idParams{Memory: 2048, Iterations: 1, Parallelism: 1})
+	require.NoError(t, err)
+	require.True(t, otherHasher.NeedsRehash(hash))
+
+	_, err = NewArgon2idHasher(Argon2idParams{})
+	require.Error(t, err)
+}
+
+func TestVerifyAcrossAlgorithms(t *testing.T) {
+	bcryptHasher, err := NewHasher(Bcrypt, bcrypt.MinCost, testArgon2idParams)
+	require.NoError(t, err)
+
+	argon2idHasher, err := NewHasher(Argon2id, bcrypt.MinCost, testArgon2idParams)
+	require.NoError(t, err)
+
+	password := util.RandomWord(10)
+
+	hash, err := bcryptHasher.Hash(password)
+	require.NoError(t, err)
+
+	require.NoError(t, argon2idHasher.Verify(hash, password))
+	require.True(t, argon2idHasher.NeedsRehash(hash))
+
+	_, err = NewHasher("md5", bcrypt.MinCost, testArgon2idParams)
+	require.Error(t, err)
+}
+
+func TestVerifyPlaintext(t *testing.T) {
+	hasher, err := NewHasher(Bcrypt, bcrypt.MinCost, testArgon2idParams)
+	require.NoError(t, err)
+
+	password := util.RandomWord(10)
+
+	require.NoError(t, hasher.Verify(password, password))
+	require.True(t, hasher.NeedsRehash(password))
+	require.ErrorIs(t, hasher.Verify(password, util.RandomWord(11)), ErrMismatchedPassword)
+
+	// malformed hashes are not mistaken for plaintext
+	require.ErrorIs(t, hasher.Verify("$argon2id$"+password, "$argon2id$"+password), ErrUnknownHashFormat)
+}
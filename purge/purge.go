@@ -0,0 +1,83 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"log"
+	"time"
+)
+
+// Purger periodically hard-deletes users which were soft-deleted longer than the retention window ago,
+// together with failed logins which are not locked and were forgotten by the lockout
+type Purger struct {
+	queries   db.Querier
+	retention time.Duration
+	// loginAttemptRetention is how long the lockout remembers failures, older ones do not count anymore
+	loginAttemptRetention time.Duration
+	interval              time.Duration
+	now                   func() time.Time
+}
+
+// NewPurger creates a new Purger
+func NewPurger(queries db.Querier, retention time.Duration, loginAttemptRetention time.Duration, interval time.Duration) (*Purger, error) {
+	if retention <= 0 || loginAttemptRetention <= 0 {
+		return nil, errors.New("retention has to be positive")
+	}
+	if interval <= 0 {
+		return nil, errors.New("interval has to be positive")
+	}
+
+	return &Purger{
+		queries:               queries,
+		retention:             retention,
+		loginAttemptRetention: loginAttemptRetention,
+		interval:              interval,
+		now:                   time.Now,
+	}, nil
+}
+
+// Run purges deleted users and stale login attempts right away and then every interval until ctx is done,
+// failures are logged and retried on the next tick
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := p.Purge(ctx)
+		if err != nil {
+			log.Println("could not purge deleted users: ", err)
+		} else if purged > 0 {
+			log.Printf("purged %d deleted users", purged)
+		}
+
+		purged, err = p.PurgeLoginAttempts(ctx)
+		if err != nil {
+			log.Println("could not purge login attempts: ", err)
+		} else if purged > 0 {
+			log.Printf("purged %d login attempts", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge hard-deletes users deleted before the retention window and returns how many of them were removed
+func (p *Purger) Purge(ctx context.Context) (int64, error) {
+	deletedBefore := p.now().UTC().Add(-p.retention)
+	return p.queries.PurgeDeletedUsers(ctx, deletedBefore)
+}
+
+// PurgeLoginAttempts deletes login attempts which last failed before the retention window and are not locked,
+// e.g. of the unknown logins tried by credential stuffing, and returns how many of them were removed
+func (p *Purger) PurgeLoginAttempts(ctx context.Context) (int64, error) {
+	now := p.now().UTC()
+	return p.queries.DeleteStaleLoginAttempts(ctx, db.DeleteStaleLoginAttemptsParams{
+		FailedBefore: now.Add(-p.loginAttemptRetention),
+		Now:          now,
+	})
+}
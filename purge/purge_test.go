@@ -0,0 +1,105 @@
+package purge
+
+import (
+	"context"
+	"database/sql"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/rafdekar/user-api/db/mock"
+	db "github.com/rafdekar/user-api/db/sqlc"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewPurger(t *testing.T) {
+	_, err := NewPurger(nil, 0, time.Hour, time.Hour)
+	require.Error(t, err)
+
+	_, err = NewPurger(nil, time.Hour, 0, time.Hour)
+	require.Error(t, err)
+
+	_, err = NewPurger(nil, time.Hour, time.Hour, 0)
+	require.Error(t, err)
+
+	purger, err := NewPurger(nil, time.Hour, time.Hour, time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, purger)
+}
+
+func TestPurge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	retention := 30 * 24 * time.Hour
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().PurgeDeletedUsers(gomock.Any(), gomock.Eq(now.Add(-retention))).
+		Times(1).
+		Return(int64(3), nil)
+
+	purger, err := NewPurger(store, retention, time.Hour, time.Hour)
+	require.NoError(t, err)
+	purger.now = func() time.Time { return now }
+
+	purged, err := purger.Purge(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(3), purged)
+}
+
+func TestPurgeLoginAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	retention := 24 * time.Hour
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().DeleteStaleLoginAttempts(gomock.Any(), gomock.Eq(db.DeleteStaleLoginAttemptsParams{
+		FailedBefore: now.UTC().Add(-retention),
+		Now:          now.UTC(),
+	})).
+		Times(1).
+		Return(int64(5), nil)
+
+	purger, err := NewPurger(store, 30*24*time.Hour, retention, time.Hour)
+	require.NoError(t, err)
+	purger.now = func() time.Time { return now }
+
+	purged, err := purger.PurgeLoginAttempts(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(5), purged)
+}
+
+func TestRunStopsWithContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().PurgeDeletedUsers(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(int64(0), sql.ErrConnDone)
+	store.EXPECT().DeleteStaleLoginAttempts(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, _ db.DeleteStaleLoginAttemptsParams) (int64, error) {
+			cancel()
+			return 0, sql.ErrConnDone
+		})
+
+	purger, err := NewPurger(store, time.Hour, time.Hour, time.Hour)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		purger.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("purger did not stop after context was cancelled")
+	}
+}
@@ -0,0 +1,88 @@
+// Package security reports security events, e.g. failed logins and locked accounts, so that they can be audited
+// and alerted on
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"log"
+	"sync"
+	"time"
+)
+
+// Types of events
+const (
+	LoginFailed     = "login_failed"
+	LoginLocked     = "login_locked"
+	AccountLocked   = "account_locked"
+	IPLocked        = "ip_locked"
+	AccountUnlocked = "account_unlocked"
+)
+
+// Event is a single security relevant action
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// UserID is the account the event concerns, it is nil when the login did not match any account
+	UserID *uuid.UUID `json:"user_id,omitempty"`
+	// ActorID is the user who performed the action on the account, e.g. an administrator unlocking it
+	ActorID     *uuid.UUID `json:"actor_id,omitempty"`
+	IP          string     `json:"ip,omitempty"`
+	Failures    int        `json:"failures,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+// Emitter is an interface for reporting security events
+type Emitter interface {
+	// Emit reports the event, failures to report it must not fail the request which caused it
+	Emit(ctx context.Context, event Event)
+}
+
+// LogEmitter writes events as JSON lines into the log, where log shippers can pick them up
+type LogEmitter struct {
+	logger *log.Logger
+}
+
+// NewLogEmitter creates a new LogEmitter
+func NewLogEmitter(logger *log.Logger) *LogEmitter {
+	return &LogEmitter{logger: logger}
+}
+
+// Emit writes the event into the log
+func (e *LogEmitter) Emit(ctx context.Context, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		e.logger.Println("could not encode security event: ", err)
+		return
+	}
+
+	e.logger.Printf("security event: %s", data)
+}
+
+// MemoryEmitter keeps events in memory, it is meant for tests
+type MemoryEmitter struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewMemoryEmitter creates a new MemoryEmitter
+func NewMemoryEmitter() *MemoryEmitter {
+	return &MemoryEmitter{}
+}
+
+// Emit stores the event
+func (e *MemoryEmitter) Emit(ctx context.Context, event Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.events = append(e.events, event)
+}
+
+// Events returns copy of all events emitted so far, in the order they were emitted
+func (e *MemoryEmitter) Events() []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Event(nil), e.events...)
+}
@@ -0,0 +1,50 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogEmitter(t *testing.T) {
+	var buffer bytes.Buffer
+	emitter := NewLogEmitter(log.New(&buffer, "", 0))
+
+	userID := uuid.New()
+	emitter.Emit(context.Background(), Event{
+		Type:     LoginFailed,
+		Time:     time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		UserID:   &userID,
+		IP:       "192.0.2.1",
+		Failures: 2,
+	})
+
+	line := strings.TrimSpace(buffer.String())
+	require.True(t, strings.HasPrefix(line, "security event: "))
+	require.JSONEq(
+		t,
+		`{"type":"login_failed","time":"2022-01-01T00:00:00Z","user_id":"`+userID.String()+`","ip":"192.0.2.1","failures":2}`,
+		strings.TrimPrefix(line, "security event: "),
+	)
+}
+
+func TestMemoryEmitter(t *testing.T) {
+	emitter := NewMemoryEmitter()
+	emitter.Emit(context.Background(), Event{Type: AccountLocked})
+	emitter.Emit(context.Background(), Event{Type: AccountUnlocked})
+
+	events := emitter.Events()
+	require.Len(t, events, 2)
+	require.Equal(t, AccountLocked, events[0].Type)
+	require.Equal(t, AccountUnlocked, events[1].Type)
+
+	// the returned slice is a copy
+	events[0].Type = LoginFailed
+	require.Equal(t, AccountLocked, emitter.Events()[0].Type)
+}
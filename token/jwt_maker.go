@@ -0,0 +1,111 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const minSecretKeySize = 32
+
+// JWTMaker is a JSON Web Token maker
+type JWTMaker struct {
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	verifyingKey  interface{}
+}
+
+// NewMaker creates a Maker for the algorithm selected in config, secretKey is used by HS256
+// and ed25519Seed by EdDSA
+func NewMaker(algorithm string, secretKey string, ed25519Seed []byte) (Maker, error) {
+	switch strings.ToUpper(algorithm) {
+	case strings.ToUpper(AlgorithmHS256):
+		return NewHS256Maker(secretKey)
+	case strings.ToUpper(AlgorithmEdDSA):
+		return NewEd25519Maker(ed25519Seed)
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm: %q", algorithm)
+	}
+}
+
+// NewHS256Maker creates a new JWTMaker signing tokens with HMAC SHA-256 and a shared secret
+func NewHS256Maker(secretKey string) (*JWTMaker, error) {
+	if len(secretKey) < minSecretKeySize {
+		return nil, fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
+	}
+
+	maker := &JWTMaker{
+		signingMethod: jwt.SigningMethodHS256,
+		signingKey:    []byte(secretKey),
+		verifyingKey:  []byte(secretKey),
+	}
+
+	return maker, nil
+}
+
+// NewEd25519Maker creates a new JWTMaker signing tokens with Ed25519 private key derived from seed
+func NewEd25519Maker(seed []byte) (*JWTMaker, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid key size: ed25519 seed must be exactly %d bytes", ed25519.SeedSize)
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	maker := &JWTMaker{
+		signingMethod: jwt.SigningMethodEdDSA,
+		signingKey:    privateKey,
+		verifyingKey:  privateKey.Public(),
+	}
+
+	return maker, nil
+}
+
+// CreateToken creates a new token of given type for specific user with given roles and duration
+func (m *JWTMaker) CreateToken(userID uuid.UUID, roles []string, tokenType Type, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(userID, roles, tokenType, duration)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token, err := jwt.NewWithClaims(m.signingMethod, payload).SignedString(m.signingKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not sign token: %w", err)
+	}
+
+	return token, payload, nil
+}
+
+// VerifyToken checks if token is valid and of expected type
+func (m *JWTMaker) VerifyToken(token string, tokenType Type) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != m.signingMethod.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return m.verifyingKey, nil
+	}
+
+	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+	if err != nil {
+		var verr *jwt.ValidationError
+		if errors.As(err, &verr) && errors.Is(verr.Inner, ErrExpiredToken) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	payload, ok := jwtToken.Claims.(*Payload)
+	if !ok || payload.Type != tokenType {
+		return nil, ErrInvalidToken
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,133 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/rafdekar/user-api/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestMakers(t *testing.T) map[string]Maker {
+	hs256Maker, err := NewHS256Maker(util.RandomWord(32))
+	require.NoError(t, err)
+
+	ed25519Maker, err := NewEd25519Maker([]byte(util.RandomWord(ed25519.SeedSize)))
+	require.NoError(t, err)
+
+	return map[string]Maker{
+		AlgorithmHS256: hs256Maker,
+		AlgorithmEdDSA: ed25519Maker,
+	}
+}
+
+func TestJWTMaker(t *testing.T) {
+	for name, maker := range newTestMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			userID := uuid.New()
+			roles := []string{util.RoleUser, util.RoleAdmin}
+			duration := time.Minute
+
+			issuedAt := time.Now()
+			expiredAt := issuedAt.Add(duration)
+
+			token, payload, err := maker.CreateToken(userID, roles, TypeAccess, duration)
+			require.NoError(t, err)
+			require.NotEmpty(t, token)
+			require.NotEmpty(t, payload)
+
+			payload, err = maker.VerifyToken(token, TypeAccess)
+			require.NoError(t, err)
+			require.NotEmpty(t, payload)
+
+			require.NotZero(t, payload.ID)
+			require.Equal(t, userID, payload.UserID)
+			require.Equal(t, roles, payload.Roles)
+			require.True(t, payload.HasRole(util.RoleAdmin))
+			require.Equal(t, TypeAccess, payload.Type)
+			require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+			require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+		})
+	}
+}
+
+func TestExpiredJWTToken(t *testing.T) {
+	for name, maker := range newTestMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			token, payload, err := maker.CreateToken(uuid.New(), []string{util.RoleUser}, TypeAccess, -time.Minute)
+			require.NoError(t, err)
+			require.NotEmpty(t, token)
+			require.NotEmpty(t, payload)
+
+			payload, err = maker.VerifyToken(token, TypeAccess)
+			require.ErrorIs(t, err, ErrExpiredToken)
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestJWTTokenOfWrongType(t *testing.T) {
+	for name, maker := range newTestMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			token, _, err := maker.CreateToken(uuid.New(), []string{util.RoleUser}, TypeRefresh, time.Minute)
+			require.NoError(t, err)
+
+			payload, err := maker.VerifyToken(token, TypeAccess)
+			require.ErrorIs(t, err, ErrInvalidToken)
+			require.Nil(t, payload)
+
+			// MFA tokens only let the user enter the second factor, they can not be used as access tokens
+			token, _, err = maker.CreateToken(uuid.New(), []string{util.RoleUser}, TypeMFA, time.Minute)
+			require.NoError(t, err)
+
+			payload, err = maker.VerifyToken(token, TypeAccess)
+			require.ErrorIs(t, err, ErrInvalidToken)
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestInvalidJWTTokenAlgNone(t *testing.T) {
+	payload, err := NewPayload(uuid.New(), []string{util.RoleUser}, TypeAccess, time.Minute)
+	require.NoError(t, err)
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, payload)
+	token, err := jwtToken.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	for name, maker := range newTestMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			payload, err := maker.VerifyToken(token, TypeAccess)
+			require.ErrorIs(t, err, ErrInvalidToken)
+			require.Nil(t, payload)
+		})
+	}
+}
+
+func TestJWTTokenSignedByOtherAlgorithm(t *testing.T) {
+	makers := newTestMakers(t)
+
+	token, _, err := makers[AlgorithmHS256].CreateToken(uuid.New(), []string{util.RoleUser}, TypeAccess, time.Minute)
+	require.NoError(t, err)
+
+	payload, err := makers[AlgorithmEdDSA].VerifyToken(token, TypeAccess)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	require.Nil(t, payload)
+}
+
+func TestNewMaker(t *testing.T) {
+	_, err := NewMaker(AlgorithmHS256, util.RandomWord(10), nil)
+	require.Error(t, err)
+
+	_, err = NewMaker(AlgorithmEdDSA, "", []byte(util.RandomWord(10)))
+	require.Error(t, err)
+
+	_, err = NewMaker("RS256", util.RandomWord(32), nil)
+	require.Error(t, err)
+
+	maker, err := NewMaker("hs256", util.RandomWord(32), nil)
+	require.NoError(t, err)
+	require.NotNil(t, maker)
+}
@@ -0,0 +1,14 @@
+package token
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Maker is an interface for managing tokens
+type Maker interface {
+	// CreateToken creates a new token of given type for specific user with given roles and duration
+	CreateToken(userID uuid.UUID, roles []string, tokenType Type, duration time.Duration) (string, *Payload, error)
+	// VerifyToken checks if token is valid and of expected type
+	VerifyToken(token string, tokenType Type) (*Payload, error)
+}
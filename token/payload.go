@@ -0,0 +1,76 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Type distinguishes short-lived access tokens from long-lived refresh tokens and from MFA tokens,
+// which prove that password of the user was checked and only let them enter the second factor
+type Type string
+
+// Supported token types
+const (
+	TypeAccess  Type = "access"
+	TypeRefresh Type = "refresh"
+	TypeMFA     Type = "mfa"
+)
+
+var (
+	// ErrInvalidToken is returned when token cannot be parsed, its signature is wrong or it has unexpected type
+	ErrInvalidToken = errors.New("token is invalid")
+	// ErrExpiredToken is returned when token is past its expiration time
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Payload contains the payload data of the token
+type Payload struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Roles     []string  `json:"roles"`
+	Type      Type      `json:"type"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+// NewPayload creates a new token payload of given type for specific user with given roles and duration
+func NewPayload(userID uuid.UUID, roles []string, tokenType Type, duration time.Duration) (*Payload, error) {
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate token id: %w", err)
+	}
+
+	now := time.Now()
+	payload := &Payload{
+		ID:        tokenID,
+		UserID:    userID,
+		Roles:     roles,
+		Type:      tokenType,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(duration),
+	}
+
+	return payload, nil
+}
+
+// Valid checks if the token payload has not expired
+func (p *Payload) Valid() error {
+	if time.Now().After(p.ExpiredAt) {
+		return ErrExpiredToken
+	}
+
+	return nil
+}
+
+// HasRole checks if the token was issued for user holding given role
+func (p *Payload) HasRole(role string) bool {
+	for _, v := range p.Roles {
+		if v == role {
+			return true
+		}
+	}
+
+	return false
+}
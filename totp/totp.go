@@ -0,0 +1,126 @@
+// Package totp implements time-based one-time passwords described by RFC 6238, which are generated by
+// authenticator apps. Time is always passed in, so that codes can be tested with a fake clock.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters which are understood by all common authenticator apps, the hash is always SHA-1
+const (
+	SecretSize = 20
+	Digits     = 6
+	Period     = 30 * time.Second
+	// Skew is the number of periods before and after the current one whose codes are accepted too,
+	// it makes up for clock drift and the time it takes to type the code
+	Skew = 1
+)
+
+// ErrInvalidSecret is returned when the secret is not base32 encoded
+var ErrInvalidSecret = errors.New("totp secret is invalid")
+
+// encoding is base32 without padding used by otpauth URIs
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret encoded in base32
+func GenerateSecret() (string, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(secret), nil
+}
+
+// decodeSecret decodes base32 secret, it accepts lower case and padded secrets which some tools produce
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.TrimRight(strings.ToUpper(secret), "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return key, nil
+}
+
+// Counter returns the number of the period t falls into
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// hotp computes the HMAC-based one-time password of RFC 4226 for the counter
+func hotp(key []byte, counter int64, digits int) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
+
+// Code returns the code of the secret valid at time t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hotp(key, Counter(t), Digits), nil
+}
+
+// Validate checks the code against the periods around time t and returns the counter of the matching period,
+// callers store it and reject codes of the same or earlier periods so that a code can not be used twice
+func Validate(secret string, code string, t time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	current := Counter(t)
+	for counter := current - Skew; counter <= current+Skew; counter++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, counter, Digits)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// URI returns the otpauth URI of the secret, authenticator apps enroll it from QR code, the account is usually
+// the email or nickname of the user
+func URI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+
+	return uri.String()
+}
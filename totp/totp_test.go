@@ -0,0 +1,95 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA-1 seed of the test vectors in appendix B of RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTP(t *testing.T) {
+	// test vectors of appendix D of RFC 4226
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range want {
+		require.Equal(t, code, hotp([]byte("12345678901234567890"), int64(counter), 6))
+	}
+}
+
+func TestRFC6238(t *testing.T) {
+	testCases := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+
+	key, err := decodeSecret(rfcSecret)
+	require.NoError(t, err)
+
+	for _, v := range testCases {
+		at := time.Unix(v.unix, 0)
+		require.Equal(t, v.want, hotp(key, Counter(at), 8))
+
+		code, err := Code(rfcSecret, at)
+		require.NoError(t, err)
+		require.Equal(t, v.want[2:], code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, 32)
+
+	now := time.Date(2022, 1, 1, 12, 0, 10, 0, time.UTC)
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+
+	counter, ok := Validate(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, Counter(now), counter)
+
+	// codes of the neighbouring periods are accepted
+	counter, ok = Validate(secret, code, now.Add(Period))
+	require.True(t, ok)
+	require.Equal(t, Counter(now), counter)
+
+	_, ok = Validate(secret, code, now.Add(-Period))
+	require.True(t, ok)
+
+	_, ok = Validate(secret, code, now.Add(2*Period))
+	require.False(t, ok)
+
+	_, ok = Validate(secret, "00000a", now)
+	require.False(t, ok)
+
+	_, ok = Validate(secret, code+"0", now)
+	require.False(t, ok)
+
+	_, ok = Validate("not base32!", code, now)
+	require.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("User API", "bob@example.com", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.Equal(t, "/User API:bob@example.com", uri.Path)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	require.Equal(t, "User API", uri.Query().Get("issuer"))
+	require.Equal(t, "6", uri.Query().Get("digits"))
+	require.Equal(t, "30", uri.Query().Get("period"))
+}
@@ -1,12 +1,66 @@
 package util
 
-import "github.com/spf13/viper"
+import (
+	"github.com/spf13/viper"
+	"time"
+)
 
 // Config is a structure for keeping all the configuration variables loaded by Viper
 type Config struct {
 	DBDriver      string `mapstructure:"DB_DRIVER"`
 	DBSource      string `mapstructure:"DB_SOURCE"`
 	ServerAddress string `mapstructure:"SERVER_ADDRESS"`
+	// TrustedProxies are CIDRs of proxies whose X-Forwarded-For header holds the client IP
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
+
+	PasswordHashAlgorithm string `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost            int    `mapstructure:"BCRYPT_COST"`
+	Argon2Memory          uint32 `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations      uint32 `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism     uint8  `mapstructure:"ARGON2_PARALLELISM"`
+
+	TokenAlgorithm       string        `mapstructure:"TOKEN_ALGORITHM"`
+	TokenSecretKey       string        `mapstructure:"API_SECRET"`
+	TokenEd25519Seed     string        `mapstructure:"TOKEN_ED25519_SEED"`
+	AccessTokenDuration  time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+
+	NameMinLength int `mapstructure:"NAME_MIN_LENGTH"`
+	NameMaxLength int `mapstructure:"NAME_MAX_LENGTH"`
+
+	EmailProviderRules             bool          `mapstructure:"EMAIL_PROVIDER_RULES"`
+	EmailVerificationURL           string        `mapstructure:"EMAIL_VERIFICATION_URL"`
+	EmailVerificationTokenDuration time.Duration `mapstructure:"EMAIL_VERIFICATION_TOKEN_DURATION"`
+	EmailVerificationRequired      bool          `mapstructure:"EMAIL_VERIFICATION_REQUIRED"`
+
+	PasswordResetURL           string        `mapstructure:"PASSWORD_RESET_URL"`
+	PasswordResetTokenDuration time.Duration `mapstructure:"PASSWORD_RESET_TOKEN_DURATION"`
+	PasswordResetEmailLimit    int           `mapstructure:"PASSWORD_RESET_EMAIL_LIMIT"`
+	PasswordResetIPLimit       int           `mapstructure:"PASSWORD_RESET_IP_LIMIT"`
+	PasswordResetLimitWindow   time.Duration `mapstructure:"PASSWORD_RESET_LIMIT_WINDOW"`
+
+	MFAIssuer        string        `mapstructure:"MFA_ISSUER"`
+	MFATokenDuration time.Duration `mapstructure:"MFA_TOKEN_DURATION"`
+	MFAAttemptLimit  int           `mapstructure:"MFA_ATTEMPT_LIMIT"`
+	MFAAttemptWindow time.Duration `mapstructure:"MFA_ATTEMPT_WINDOW"`
+
+	LockoutStore            string        `mapstructure:"LOCKOUT_STORE"`
+	LockoutAccountAttempts  int           `mapstructure:"LOCKOUT_ACCOUNT_ATTEMPTS"`
+	LockoutIPAttempts       int           `mapstructure:"LOCKOUT_IP_ATTEMPTS"`
+	LockoutBaseDelay        time.Duration `mapstructure:"LOCKOUT_BASE_DELAY"`
+	LockoutMaxDelay         time.Duration `mapstructure:"LOCKOUT_MAX_DELAY"`
+	LockoutFailureRetention time.Duration `mapstructure:"LOCKOUT_FAILURE_RETENTION"`
+
+	Mailer       string `mapstructure:"MAILER"`
+	MailFrom     string `mapstructure:"MAIL_FROM"`
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+	MailDir      string `mapstructure:"MAIL_DIR"`
+
+	SoftDeleteRetention time.Duration `mapstructure:"SOFT_DELETE_RETENTION"`
+	PurgeInterval       time.Duration `mapstructure:"PURGE_INTERVAL"`
 }
 
 // LoadConfig is a function for loading config from specified location
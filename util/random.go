@@ -59,7 +59,7 @@ func RandomProvider() string {
 
 func RandomCountry() string {
 	countries := []string{
-		"UK",
+		"GB",
 		"DE",
 		"NL",
 		"PL",
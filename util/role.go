@@ -0,0 +1,8 @@
+package util
+
+// Roles which can be granted to users
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)